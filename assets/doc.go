@@ -0,0 +1,5 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+// Provides handlers for serving a site's static assets.
+package assets
@@ -0,0 +1,87 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package assets
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/lazyengineering/gobase/middleware"
+)
+
+// The precompressed siblings FileServer looks for, by content-coding, in order of preference
+var precompressed = []struct {
+	Encoding  string
+	Extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// FileServer serves files from root like http.FileServer, except that when a file has a
+// precompressed sibling the request accepts (e.g. "app.js.br" or "app.js.gz" for "app.js"),
+// that is served instead, with the Content-Type of the original and a Content-Encoding.
+// Other files are served as they are; to compress them on the fly, wrap FileServer in
+// middleware.Compress, which leaves precompressed responses alone (main.Handle wraps every
+// route in it). Range requests apply to the body as sent.
+func FileServer(root http.FileSystem) http.Handler {
+	files := http.FileServer(root)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if strings.HasSuffix(r.URL.Path, "/") || len(ctype) == 0 {
+			files.ServeHTTP(w, r)
+			return
+		}
+		names := make([]string, 0, len(precompressed))
+		for _, p := range precompressed {
+			if exists(root, name+p.Extension) {
+				names = append(names, p.Encoding)
+			}
+		}
+		if len(names) == 0 {
+			files.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := middleware.NegotiateEncoding(r.Header.Get("Accept-Encoding"), names...)
+		if len(encoding) == 0 {
+			files.ServeHTTP(w, r)
+			return
+		}
+		for _, p := range precompressed {
+			if p.Encoding == encoding {
+				name += p.Extension
+				break
+			}
+		}
+		f, err := root.Open(name)
+		if err != nil {
+			files.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			files.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Encoding", encoding)
+		http.ServeContent(w, r, name, info.ModTime(), f)
+	})
+}
+
+// exists reports whether name is a regular file in root
+func exists(root http.FileSystem, name string) bool {
+	f, err := root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package assets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lazyengineering/gobase/middleware"
+)
+
+// FileServer should serve the precompressed sibling the request prefers, when there is one
+func TestFileServer(t *testing.T) {
+	big := strings.Repeat("var a = 1;\n", 200)
+	files := http.FS(fstest.MapFS{
+		"app.js":      {Data: []byte(big)},
+		"app.js.gz":   {Data: []byte("gzipped app")},
+		"app.js.br":   {Data: []byte("brotli app")},
+		"lib.js":      {Data: []byte(big)},
+		"lib.js.gz":   {Data: []byte("gzipped lib")},
+		"site.css":    {Data: []byte(big)},
+		"logo.png":    {Data: []byte("not really a png")},
+		"logo.png.gz": {Data: []byte("gzipped png")},
+	})
+	type testCase struct {
+		Path     string
+		Accept   string
+		Range    string
+		Status   int
+		Encoding string
+		Type     string
+		Body     string // expected body, unless empty
+	}
+
+	// path     | accept-encoding | range | STATUS ENCODING TYPE       BODY
+	// app.js   | gzip, br        |       | 200    br       javascript brotli app
+	// app.js   | gzip            |       | 200    gzip     javascript gzipped app
+	// lib.js   | br, gzip        |       | 200    gzip     javascript gzipped lib
+	// lib.js   |                 |       | 200             javascript original
+	// site.css | gzip            |       | 200    gzip     css        (compressed on the fly)
+	// app.js   | br              | 0-5   | 206    br       javascript brotli
+	// logo.png | gzip            |       | 200    gzip     png        gzipped png
+	testCases := []testCase{
+		{"/app.js", "gzip, br", "", 200, "br", "text/javascript; charset=utf-8", "brotli app"},
+		{"/app.js", "gzip", "", 200, "gzip", "text/javascript; charset=utf-8", "gzipped app"},
+		{"/lib.js", "br, gzip", "", 200, "gzip", "text/javascript; charset=utf-8", "gzipped lib"},
+		{"/lib.js", "", "", 200, "", "text/javascript; charset=utf-8", big},
+		{"/site.css", "gzip", "", 200, "gzip", "text/css; charset=utf-8", ""},
+		{"/app.js", "br", "bytes=0-5", 206, "br", "text/javascript; charset=utf-8", "brotli"},
+		{"/logo.png", "gzip", "", 200, "gzip", "image/png", "gzipped png"},
+	}
+	for idx, tc := range testCases {
+		req := httptest.NewRequest("GET", tc.Path, nil)
+		if len(tc.Accept) > 0 {
+			req.Header.Set("Accept-Encoding", tc.Accept)
+		}
+		if len(tc.Range) > 0 {
+			req.Header.Set("Range", tc.Range)
+		}
+		res := httptest.NewRecorder()
+		middleware.Compress(nil, FileServer(files)).ServeHTTP(res, req) // as main.Handle serves it
+
+		if res.Code != tc.Status {
+			t.Error("test\t", idx, "\texpected:\t", tc.Status, "\tactual:\t", res.Code)
+		}
+		if e := res.Header().Get("Content-Encoding"); e != tc.Encoding {
+			t.Error("test\t", idx, "\texpected:\t", tc.Encoding, "\tactual:\t", e)
+		}
+		if ct := res.Header().Get("Content-Type"); ct != tc.Type {
+			t.Error("test\t", idx, "\texpected:\t", tc.Type, "\tactual:\t", ct)
+		}
+		if v := res.Header().Get("Vary"); v != "Accept-Encoding" {
+			t.Error("test\t", idx, "\texpected:\t", "Accept-Encoding", "\tactual:\t", v)
+		}
+		if body := res.Body.String(); len(tc.Body) > 0 && body != tc.Body {
+			t.Error("test\t", idx, "\texpected:\t", tc.Body, "\tactual:\t", body)
+		}
+	}
+	// on its own, FileServer leaves compressing other files to middleware.Compress
+	req := httptest.NewRequest("GET", "/site.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := httptest.NewRecorder()
+	FileServer(files).ServeHTTP(res, req)
+	if e := res.Header().Get("Content-Encoding"); e != "" {
+		t.Error("expected:\t", "", "\tactual:\t", e)
+	}
+}
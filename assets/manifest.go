@@ -0,0 +1,115 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package assets
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Compressed siblings and templates are not fingerprinted
+var unfingerprinted = []string{".gz", ".br", ".html"}
+
+// Manifest maps the files of a static folder to fingerprinted paths, which include a hash of
+// their content (e.g. "/css/main.3f2a1b9c.css" for "css/main.css"), so that they can be cached
+// forever: a changed file gets a new path. It also keeps the Subresource Integrity hash of
+// each file, for checking copies of vendored files served from a CDN.
+type Manifest struct {
+	paths     map[string]string // by file name, e.g. "css/main.css"
+	files     map[string]string // by fingerprinted path, e.g. "/css/main.3f2a1b9c.css"
+	integrity map[string]string // by file name
+}
+
+// Create a Manifest by hashing every file in fsys, except compressed siblings and templates.
+func NewManifest(fsys fs.FS) (*Manifest, error) {
+	t := time.Now()
+	m := &Manifest{
+		paths:     make(map[string]string),
+		files:     make(map[string]string),
+		integrity: make(map[string]string),
+	}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		for _, ext := range unfingerprinted {
+			if path.Ext(name) == ext {
+				return nil
+			}
+		}
+		sum, integrity, err := hash(fsys, name)
+		if err != nil {
+			return err
+		}
+		ext := path.Ext(name)
+		p := "/" + strings.TrimSuffix(name, ext) + "." + sum[:8] + ext
+		m.paths[name] = p
+		m.files[p] = name
+		m.integrity[name] = integrity
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("\x1b[1;35mAssets:\x1b[0m \x1b[34m%6d\x1b[0mµs \x1b[33m%d files\x1b[0m", time.Since(t).Nanoseconds()/1000, len(m.paths))
+	return m, nil
+}
+
+// Path returns the fingerprinted path for the named file (e.g. "css/main.css"), or the
+// plain path when the file is not in the Manifest.
+func (m *Manifest) Path(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if p, ok := m.paths[name]; ok {
+		return p
+	}
+	return "/" + name
+}
+
+// Integrity returns the Subresource Integrity hash of the named file (e.g. "sha384-..."),
+// or "" when the file is not in the Manifest.
+func (m *Manifest) Integrity(name string) string {
+	return m.integrity[strings.TrimPrefix(path.Clean("/"+name), "/")]
+}
+
+// Handler serves fingerprinted paths with h, as the paths of the files they name, and marks
+// them to be cached for a year without revalidating. Other paths are passed to h unchanged.
+// To override caching set by other middleware, such as middleware.Cache, wrap h
+// after that middleware.
+func (m *Manifest) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := m.files[r.URL.Path]
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("Expires", time.Now().Add(365*24*time.Hour).Format(time.RFC1123))
+		r = r.Clone(r.Context())
+		r.URL.Path, r.URL.RawPath = "/"+name, ""
+		h.ServeHTTP(w, r)
+	})
+}
+
+// hash returns the hex SHA-256 of the named file's content, and its SHA-384 integrity hash
+func hash(fsys fs.FS, name string) (string, string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	h, i := sha256.New(), sha512.New384()
+	if _, err := io.Copy(io.MultiWriter(h, i), f); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), "sha384-" + base64.StdEncoding.EncodeToString(i.Sum(nil)), nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package assets
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"testing/fstest"
+)
+
+// A Manifest should fingerprint files by content and serve them at their fingerprinted paths
+func TestManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"css/main.css":          {Data: []byte("body {}")},
+		"css/copy.css":          {Data: []byte("body {}")},
+		"js/main.js":            {Data: []byte("alert(1)")},
+		"js/main.js.gz":         {Data: []byte("gzipped")},
+		"templates/layout.html": {Data: []byte("<html>")},
+	}
+	m, err := NewManifest(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		Name string
+		Path *regexp.Regexp
+	}
+	testCases := []testCase{
+		{"css/main.css", regexp.MustCompile(`^/css/main\.[0-9a-f]{8}\.css$`)},
+		{"/js/main.js", regexp.MustCompile(`^/js/main\.[0-9a-f]{8}\.js$`)},
+		{"js/main.js.gz", regexp.MustCompile(`^/js/main\.js\.gz$`)},
+		{"templates/layout.html", regexp.MustCompile(`^/templates/layout\.html$`)},
+		{"missing.css", regexp.MustCompile(`^/missing\.css$`)},
+	}
+	for idx, tc := range testCases {
+		if p := m.Path(tc.Name); !tc.Path.MatchString(p) {
+			t.Error("test\t", idx, "\texpected:\t", tc.Path, "\tactual:\t", p)
+		}
+	}
+	if a, b := m.Path("css/main.css"), m.Path("css/copy.css"); a[len("/css/main."):] != b[len("/css/copy."):] {
+		t.Error("expected:\tsame hash for the same content\tactual:\t", a, b)
+	}
+
+	if i := m.Integrity("css/main.css"); i != "sha384-"+integrity("body {}") {
+		t.Error("expected:\t", "sha384-"+integrity("body {}"), "\tactual:\t", i)
+	}
+	if i := m.Integrity("missing.css"); i != "" {
+		t.Error("expected:\t", "", "\tactual:\t", i)
+	}
+
+	h := m.Handler(FileServer(http.FS(fsys)))
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("GET", m.Path("js/main.js"), nil))
+	if body, _ := io.ReadAll(res.Body); res.Code != http.StatusOK || string(body) != "alert(1)" {
+		t.Error("expected:\t", 200, "alert(1)", "\tactual:\t", res.Code, string(body))
+	}
+	if cc := res.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Error("expected:\t", "public, max-age=31536000, immutable", "\tactual:\t", cc)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("GET", "/js/main.js", nil))
+	if res.Code != http.StatusOK || len(res.Header().Get("Cache-Control")) > 0 {
+		t.Error("expected:\t", 200, "no Cache-Control", "\tactual:\t", res.Code, res.Header().Get("Cache-Control"))
+	}
+}
+
+func integrity(content string) string {
+	sum := sha512.Sum384([]byte(content))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
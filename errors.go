@@ -4,132 +4,28 @@
 package main
 
 import (
-	"log"
 	"net/http"
+
+	"github.com/lazyengineering/gobase/layouts"
 )
 
-const page500 = `<!DOCTYPE html>
-<html lang="en">
-<head>
-  <meta charset="utf-8">
-  <meta http-equiv="X-UA-Compatible" content="IE=edge">
-  <meta name="viewport" content="width=device-width, initial-scale=1.0">
-  <meta name="description" content="">
-  <meta name="author" content="">
-  <title>500 – It Broke.</title>
-  <!-- Latest compiled and minified CSS -->
-  <link rel="stylesheet" href="//netdna.bootstrapcdn.com/bootstrap/3.0.2/css/bootstrap.min.css">
-  <!-- Custom styles for this template -->
-  <link href="/css/main.css" rel="stylesheet">
-  <!-- HTML5 shim and Respond.js IE8 support of HTML5 elements and media queries -->
-  <!--[if lt IE 9]>
-    <script src="https://oss.maxcdn.com/libs/html5shiv/3.7.0/html5shiv.js"></script>
-    <script src="https://oss.maxcdn.com/libs/respond.js/1.3.0/respond.min.js"></script>
-  <![endif]-->
-</head>
-<body>
-  <div class="container">
-    <div class="error-message">
-      <h1>500</h1>
-      <p class="lead">It broke. We'll have to fix it.</p>
-    </div>
-  </div><!-- /.container -->
-  <!-- Bootstrap core JavaScript
-  ================================================== -->
-  <!-- Placed at the end of the document so the pages load faster -->
-  <script src="https://code.jquery.com/jquery-1.10.2.min.js"></script>
-  <!-- Latest compiled and minified JavaScript -->
-  <script src="//netdna.bootstrapcdn.com/bootstrap/3.0.2/js/bootstrap.min.js"></script>
-</body>
-</html>`
+// Error pages rendered through the Layout, from the templates in the error-templates folder
+var ErrorPages *layouts.ErrorPages
 
-func Error500(res http.ResponseWriter, req *http.Request, err error) {
-	log.Println("\x1b[1;31mError:\x1b[0m", req.URL.String(), err)
-	res.Header().Set("Content-Type", "text/html; charset=utf-8")
-	res.WriteHeader(http.StatusInternalServerError)
-	res.Write([]byte(page500))
+// Error answers an error from an Action with the page for its status,
+// treating errors without one as a 500.
+func Error(res http.ResponseWriter, req *http.Request, err error) {
+	ErrorPages.Render(res, req, layouts.StatusCode(err), err)
 }
 
-const page404 = `<!DOCTYPE html>
-<html lang="en">
-<head>
-  <meta charset="utf-8">
-  <meta http-equiv="X-UA-Compatible" content="IE=edge">
-  <meta name="viewport" content="width=device-width, initial-scale=1.0">
-  <meta name="description" content="">
-  <meta name="author" content="">
-  <title>404 – Not Found</title>
-  <!-- Latest compiled and minified CSS -->
-  <link rel="stylesheet" href="//netdna.bootstrapcdn.com/bootstrap/3.0.2/css/bootstrap.min.css">
-  <!-- Custom styles for this template -->
-  <link href="/css/main.css" rel="stylesheet">
-  <!-- HTML5 shim and Respond.js IE8 support of HTML5 elements and media queries -->
-  <!--[if lt IE 9]>
-    <script src="https://oss.maxcdn.com/libs/html5shiv/3.7.0/html5shiv.js"></script>
-    <script src="https://oss.maxcdn.com/libs/respond.js/1.3.0/respond.min.js"></script>
-  <![endif]-->
-</head>
-<body>
-  <div class="container">
-    <div class="error-message">
-      <h1>404</h1>
-      <p class="lead">You won't find what you're looking for here.</p>
-    </div>
-  </div><!-- /.container -->
-  <!-- Bootstrap core JavaScript
-  ================================================== -->
-  <!-- Placed at the end of the document so the pages load faster -->
-  <script src="https://code.jquery.com/jquery-1.10.2.min.js"></script>
-  <!-- Latest compiled and minified JavaScript -->
-  <script src="//netdna.bootstrapcdn.com/bootstrap/3.0.2/js/bootstrap.min.js"></script>
-</body>
-</html>`
+func Error500(res http.ResponseWriter, req *http.Request, err error) {
+	ErrorPages.Render(res, req, http.StatusInternalServerError, err)
+}
 
 func Error404(res http.ResponseWriter, req *http.Request) {
-	log.Println("\x1b[1;31mNot Found:\x1b[0m", req.URL.String())
-	res.Header().Set("Content-Type", "text/html; charset=utf-8")
-	res.WriteHeader(http.StatusNotFound)
-	res.Write([]byte(page404))
+	ErrorPages.Render(res, req, http.StatusNotFound, nil)
 }
 
-const page403 = `<!DOCTYPE html>
-<html lang="en">
-<head>
-  <meta charset="utf-8">
-  <meta http-equiv="X-UA-Compatible" content="IE=edge">
-  <meta name="viewport" content="width=device-width, initial-scale=1.0">
-  <meta name="description" content="">
-  <meta name="author" content="">
-  <title>403 – Forbidden</title>
-  <!-- Latest compiled and minified CSS -->
-  <link rel="stylesheet" href="//netdna.bootstrapcdn.com/bootstrap/3.0.2/css/bootstrap.min.css">
-  <!-- Custom styles for this template -->
-  <link href="/css/main.css" rel="stylesheet">
-  <!-- HTML5 shim and Respond.js IE8 support of HTML5 elements and media queries -->
-  <!--[if lt IE 9]>
-    <script src="https://oss.maxcdn.com/libs/html5shiv/3.7.0/html5shiv.js"></script>
-    <script src="https://oss.maxcdn.com/libs/respond.js/1.3.0/respond.min.js"></script>
-  <![endif]-->
-</head>
-<body>
-  <div class="container">
-    <div class="error-message">
-      <h1>403</h1>
-      <p class="lead">Ah, ah, ah, you didn't say the magic word…</p>
-    </div>
-  </div><!-- /.container -->
-  <!-- Bootstrap core JavaScript
-  ================================================== -->
-  <!-- Placed at the end of the document so the pages load faster -->
-  <script src="https://code.jquery.com/jquery-1.10.2.min.js"></script>
-  <!-- Latest compiled and minified JavaScript -->
-  <script src="//netdna.bootstrapcdn.com/bootstrap/3.0.2/js/bootstrap.min.js"></script>
-</body>
-</html>`
-
 func Error403(res http.ResponseWriter, req *http.Request) {
-	log.Println("\x1b[1;31mNot Allowed:\x1b[0m", req.URL.String())
-	res.Header().Set("Content-Type", "text/html; charset=utf-8")
-	res.WriteHeader(http.StatusForbidden)
-	res.Write([]byte(page403))
+	ErrorPages.Render(res, req, http.StatusForbidden, nil)
 }
@@ -4,57 +4,200 @@
 package layouts
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"log"
 	"net/http"
+	"runtime/debug"
 	"sync"
 	"time"
+
+	"github.com/lazyengineering/gobase/middleware"
+	"github.com/lazyengineering/gobase/sessions"
 )
 
 // An Action does the unique work for an http response where the result should be
 // a page rendered from a template executed with unique data.
+// The request's context is canceled when the client goes away, when a sibling
+// Action in MergeActions fails, or when a Timeout expires, so long-running
+// Actions should watch r.Context().
 type Action func(*http.Request) (map[string]interface{}, error)
 
-// Returns an Action that runs the original Action when there is no cached value.
-// The cached value is unset after the given ttl (time to live) duration.
-// A negative ttl will permanently cache
-func (a Action) cache(ttl time.Duration) Action {
-	var data map[string]interface{}
-	lock := sync.RWMutex{}
+// A ContextAction is an Action that takes its context explicitly.
+type ContextAction func(context.Context, *http.Request) (map[string]interface{}, error)
+
+// Action adapts a ContextAction so it can be used anywhere an Action can,
+// passing along the request's context.
+func (a ContextAction) Action() Action {
 	return func(r *http.Request) (map[string]interface{}, error) {
-		lock.RLock()
-		if data != nil {
-			lock.RUnlock()
-			return data, nil
+		return a(r.Context(), r)
+	}
+}
+
+// Returns an Action that must complete within d. The original Action sees a
+// context with the deadline applied; if the deadline passes first, ErrTimeout
+// is returned without waiting for the original Action to finish.
+func (a Action) Timeout(d time.Duration) Action {
+	return timeout(a, d)
+}
+
+func timeout[T any](a func(*http.Request) (T, error), d time.Duration) func(*http.Request) (T, error) {
+	type result struct {
+		data T
+		err  error
+	}
+	return func(r *http.Request) (T, error) {
+		var zero T
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		c := make(chan result, 1)
+		go func() {
+			data, err := a(r.WithContext(ctx))
+			c <- result{data, err}
+		}()
+		select {
+		case res := <-c:
+			if res.err != nil && ctx.Err() == context.DeadlineExceeded {
+				return zero, ErrTimeout
+			}
+			return res.data, res.err
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return zero, ErrTimeout
+			}
+			return zero, ctx.Err()
 		}
-		lock.RUnlock()
+	}
+}
 
+// Returns an action that runs the original action when there is no cached value
+// for the request's key under the given CachePolicy.
+// A cached value expires after the given ttl (time to live) duration.
+// A negative ttl will permanently cache, though entries may still be evicted to
+// keep within the policy's size.
+//
+// Concurrent requests for the same key share a single run of the original Action,
+// which is not canceled with any one of them; each stops waiting when its own
+// context is done.
+// Unless the policy has its own Key, the original Action sees no session (see
+// sessions.From), since DefaultCacheKey would share one client's data with
+// everyone; an Action reading the session needs a Key that varies on its cookie.
+// Within the policy's StaleWhileRevalidate window an expired value is returned
+// immediately while it is refreshed in the background, and within its
+// StaleIfError window an expired value is returned in place of an error.
+func cached[T any](a func(*http.Request) (T, error), ttl time.Duration, p CachePolicy) func(*http.Request) (T, error) {
+	key := p.key()
+	// detach a request for a run shared by other requests
+	detach := func(r *http.Request) *http.Request {
+		ctx := context.WithoutCancel(r.Context())
+		if p.Key == nil {
+			ctx = sessions.Without(ctx)
+		}
+		return r.WithContext(ctx)
+	}
+	entries := newLRU[T](p.size())
+	calls := make(map[string]*cacheCall[T])
+	lock := sync.Mutex{}
+
+	// run the original action for the call, storing the result; a panic becomes the call's
+	// error, so that the call still finishes and later requests don't wait on it forever
+	do := func(k string, r *http.Request, c *cacheCall[T]) {
+		defer close(c.done)
+		defer func() {
+			if v := recover(); v != nil {
+				c.err = fmt.Errorf("panic: %v", v)
+				log.Printf("\x1b[1;31mPanic:\x1b[0m %s\x1b[33m%s\x1b[0m %v\n%s", middleware.RequestTag(r.Context()), k, v, debug.Stack())
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			delete(calls, k)
+			if c.err == nil {
+				var expires time.Time
+				if ttl > 0 {
+					expires = time.Now().Add(ttl)
+				}
+				entries.add(k, c.data, expires)
+			}
+		}()
+		c.data, c.err = a(r)
+	}
+
+	return func(r *http.Request) (T, error) {
+		k := key(r)
+		now := time.Now()
 		lock.Lock()
-		defer lock.Unlock()
-		var err error
-		data, err = a(r)
-		if data != nil {
-			if ttl > 0 {
-				time.AfterFunc(ttl, func() {
-					lock.Lock()
-					data = nil
-					lock.Unlock()
-				})
+		var stale T
+		var staleUntil time.Time // zero when there is no stale value
+		if e, ok := entries.get(k); ok {
+			data := e.data
+			if !e.expired(now) {
+				lock.Unlock()
+				return data, nil
+			}
+			if now.Before(e.expires.Add(p.StaleWhileRevalidate)) {
+				if _, running := calls[k]; !running {
+					c := newCacheCall[T]()
+					calls[k] = c
+					// the refresh outlives this request, so it must not be canceled with it;
+					// do recovers from a panic, which would otherwise crash the server here
+					go func() {
+						do(k, detach(r), c)
+						if c.err != nil {
+							log.Printf("\x1b[1;31mRefresh:\x1b[0m %s\x1b[33m%s\x1b[0m %v", middleware.RequestTag(r.Context()), k, c.err)
+						}
+					}()
+				}
+				lock.Unlock()
+				return data, nil
 			}
+			stale, staleUntil = data, e.expires.Add(p.StaleIfError)
+		}
+		c, running := calls[k]
+		if !running {
+			c = newCacheCall[T]()
+			calls[k] = c
+			// the call is shared by every request waiting on it, so it must not be canceled
+			// with the request that started it
+			go do(k, detach(r), c)
+		}
+		lock.Unlock()
+		select {
+		case <-c.done:
+		case <-r.Context().Done():
+			var zero T
+			return zero, r.Context().Err()
+		}
+		if c.err != nil && time.Now().Before(staleUntil) {
+			return stale, nil
 		}
-		return data, err
+		return c.data, c.err
 	}
 }
 
+// cacheCall is an in-flight run of a cached action, shared by all the requests waiting on it.
+type cacheCall[T any] struct {
+	done chan struct{} // closed when data and err are set
+	data T
+	err  error
+}
+
+func newCacheCall[T any]() *cacheCall[T] {
+	return &cacheCall[T]{done: make(chan struct{})}
+}
+
 // Calls several actions together in order to return a superset of data.
 // Duplicate keys in the returned map are resolved with the first action
 // in the arguments taking priority, except where the value is a slice of
 // strings, which will be merged.
+// Every action receives a context derived from the request's; the first error
+// cancels it so that the remaining actions can stop early.
 func MergeActions(actions ...Action) Action {
 	return func(req *http.Request) (map[string]interface{}, error) {
-		done := make(chan struct{})
-		defer close(done)
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
 
-		c, errc := mergeActions(done, actions, req)
+		c, errc := mergeActions(ctx, actions, req.WithContext(ctx))
 
 		unmergedData := make([]map[string]interface{}, len(actions), len(actions))
 		for r := range c {
@@ -88,7 +231,7 @@ type actionResult struct {
 	Err   error
 }
 
-func mergeActions(done <-chan struct{}, actions []Action, req *http.Request) (<-chan actionResult, <-chan error) {
+func mergeActions(ctx context.Context, actions []Action, req *http.Request) (<-chan actionResult, <-chan error) {
 	c := make(chan actionResult)
 	errc := make(chan error, 1)
 	go func() {
@@ -102,13 +245,13 @@ func mergeActions(done <-chan struct{}, actions []Action, req *http.Request) (<-
 				data, err := action(req)
 				select {
 				case c <- actionResult{idx, data, err}:
-				case <-done:
+				case <-ctx.Done():
 				}
 				wg.Done()
 			}(i, a)
 			select {
-			case <-done:
-				canceled = errors.New("actions canceled")
+			case <-ctx.Done():
+				canceled = errActionsCanceled
 			default:
 				canceled = nil
 			}
@@ -0,0 +1,124 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The number of entries kept for each cached Action when a CachePolicy does not specify a Size
+const DefaultCacheSize = 256
+
+// A CacheKey maps a request to the key its Action data is cached under. Requests with
+// the same key share cached data, so the key must capture everything the data depends on.
+type CacheKey func(*http.Request) string
+
+// CachePolicy controls how Act caches the data returned by Actions for the
+// LowVolatility, MediumVolatility, HighVolatility, and NoVolatility levels.
+type CachePolicy struct {
+	Key  CacheKey // defaults to DefaultCacheKey
+	Size int      // maximum number of keys cached per handler, least recently used are evicted first; defaults to DefaultCacheSize
+
+	// How long past expiration a value may be served while a single background refresh runs.
+	// Zero means requests wait on the refresh instead.
+	StaleWhileRevalidate time.Duration
+	// How long past expiration a value may be served when refreshing it fails.
+	// Zero means the error is passed along to the ErrorHandler.
+	StaleIfError time.Duration
+}
+
+func (p CachePolicy) key() CacheKey {
+	if p.Key == nil {
+		return DefaultCacheKey
+	}
+	return p.Key
+}
+
+func (p CachePolicy) size() int {
+	if p.Size <= 0 {
+		return DefaultCacheSize
+	}
+	return p.Size
+}
+
+// DefaultCacheKey keys a request by its method, path, and query with parameters sorted by name.
+func DefaultCacheKey(r *http.Request) string {
+	return r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+// VaryCacheKey extends DefaultCacheKey with the values of the named headers and cookies,
+// for Actions whose data depends on them (e.g. "Accept-Language" or a session cookie).
+func VaryCacheKey(headers []string, cookies []string) CacheKey {
+	return func(r *http.Request) string {
+		key := DefaultCacheKey(r)
+		for _, h := range headers {
+			key += "\n" + http.CanonicalHeaderKey(h) + ": " + strings.Join(r.Header[http.CanonicalHeaderKey(h)], ", ")
+		}
+		for _, name := range cookies {
+			key += "\nCookie " + name + "="
+			if c, err := r.Cookie(name); err == nil {
+				key += c.Value
+			}
+		}
+		return key
+	}
+}
+
+// lru is a fixed size, least recently used cache of action data.
+// It is not safe for concurrent use.
+type lru[T any] struct {
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry[T any] struct {
+	key     string
+	data    T
+	expires time.Time // zero value never expires
+}
+
+func (e *lruEntry[T]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+func newLRU[T any](size int) *lru[T] {
+	return &lru[T]{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *lru[T]) get(key string) (*lruEntry[T], bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry[T]), true
+}
+
+func (c *lru[T]) add(key string, data T, expires time.Time) {
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		e := el.Value.(*lruEntry[T])
+		e.data, e.expires = data, expires
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry[T]{key, data, expires})
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back().Value.(*lruEntry[T]).key)
+	}
+}
+
+func (c *lru[T]) remove(key string) {
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lazyengineering/gobase/sessions"
+)
+
+func TestDefaultCacheKey(t *testing.T) {
+	a := httptest.NewRequest("GET", "/path?b=2&a=1", nil)
+	b := httptest.NewRequest("GET", "/path?a=1&b=2", nil)
+	c := httptest.NewRequest("GET", "/path?a=2&b=2", nil)
+	d := httptest.NewRequest("HEAD", "/path?a=1&b=2", nil)
+	if DefaultCacheKey(a) != DefaultCacheKey(b) {
+		t.Error("expected:\t", DefaultCacheKey(a), "\tactual:\t", DefaultCacheKey(b))
+	}
+	if DefaultCacheKey(b) == DefaultCacheKey(c) {
+		t.Error("query values should change the key:\t", DefaultCacheKey(b))
+	}
+	if DefaultCacheKey(b) == DefaultCacheKey(d) {
+		t.Error("method should change the key:\t", DefaultCacheKey(b))
+	}
+}
+
+func TestVaryCacheKey(t *testing.T) {
+	key := VaryCacheKey([]string{"accept-language"}, []string{"session"})
+	a := httptest.NewRequest("GET", "/", nil)
+	a.Header.Set("Accept-Language", "en")
+	a.AddCookie(&http.Cookie{Name: "session", Value: "alice"})
+	b := httptest.NewRequest("GET", "/", nil)
+	b.Header.Set("Accept-Language", "en")
+	b.AddCookie(&http.Cookie{Name: "session", Value: "bob"})
+	c := httptest.NewRequest("GET", "/", nil)
+	c.Header.Set("Accept-Language", "fr")
+	c.AddCookie(&http.Cookie{Name: "session", Value: "alice"})
+	d := httptest.NewRequest("GET", "/", nil)
+	d.Header.Set("Accept-Language", "en")
+	d.AddCookie(&http.Cookie{Name: "session", Value: "alice"})
+	d.AddCookie(&http.Cookie{Name: "other", Value: "ignored"})
+
+	if key(a) == key(b) {
+		t.Error("cookie should change the key:\t", key(a))
+	}
+	if key(a) == key(c) {
+		t.Error("header should change the key:\t", key(a))
+	}
+	if key(a) != key(d) {
+		t.Error("expected:\t", key(a), "\tactual:\t", key(d))
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := newLRU[map[string]interface{}](2)
+	c.add("a", map[string]interface{}{"Count": 1}, time.Time{})
+	c.add("b", map[string]interface{}{"Count": 2}, time.Time{})
+	c.get("a") // a is now most recently used
+	c.add("c", map[string]interface{}{"Count": 3}, time.Time{})
+	if _, ok := c.get("b"); ok {
+		t.Error("expected:\tb evicted\tactual:\tb cached")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok := c.get(k); !ok {
+			t.Error("expected:\t", k, "cached\tactual:\t", k, "evicted")
+		}
+	}
+	c.add("a", map[string]interface{}{"Count": 4}, time.Now().Add(-time.Second))
+	if e, _ := c.get("a"); e.data["Count"] != 4 || !e.expired(time.Now()) {
+		t.Error("expected:\texpired Count 4\tactual:\t", e.data, e.expires)
+	}
+}
+
+func TestActKeyedCache(t *testing.T) {
+	l, err := New(nil, "base", ".test/base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Cache.Size = 1
+	service := httptest.NewServer(l.Act(CountNilAction(t), nil, LowVolatility))
+	defer service.Close()
+
+	// path  | Body
+	// ------|-----
+	// ?a=1  | 1
+	// ?a=1  | 1
+	// ?a=2  | 2
+	// ?a=1  | 3 (evicted by ?a=2)
+	for idx, tc := range []struct {
+		Query string
+		Body  string
+	}{
+		{"?a=1", "1"},
+		{"?a=1", "1"},
+		{"?a=2", "2"},
+		{"?a=1", "3"},
+	} {
+		if r, err := http.Get(service.URL + tc.Query); err != nil {
+			t.Error(err)
+		} else {
+			body, errr := ioutil.ReadAll(r.Body)
+			if errr != nil {
+				t.Error(errr)
+			}
+			if strings.TrimSpace(string(body)) != tc.Body {
+				t.Error("test\t", idx, "\texpected:\t", tc.Body, "\tactual:\t", string(body))
+			}
+		}
+	}
+}
+
+// SequenceAction returns the next result from results on each call, after the delay.
+func SequenceAction(delay time.Duration, calls *int32, results ...error) Action {
+	return Action(func(r *http.Request) (map[string]interface{}, error) {
+		n := atomic.AddInt32(calls, 1)
+		<-time.After(delay)
+		if err := results[int(n-1)%len(results)]; err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"Count": int(n)}, nil
+	})
+}
+
+func TestCacheSingleFlight(t *testing.T) {
+	var calls int32
+	a := cached(SequenceAction(50*time.Millisecond, &calls, nil), time.Hour, CachePolicy{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data, err := a(httptest.NewRequest("GET", "/", nil)); err != nil {
+				t.Error(err)
+			} else if data["Count"] != 1 {
+				t.Error("expected:\tCount 1\tactual:\t", data)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("expected:\t1 call\tactual:\t", n, "calls")
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	a := cached(SequenceAction(50*time.Millisecond, &calls, nil), 100*time.Millisecond, CachePolicy{
+		StaleWhileRevalidate: time.Hour,
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+
+	// Delay | Count | Note
+	// ------|-------|-----------------------------------
+	// 0     | 1     | first call waits on the action
+	// 110ms | 1     | stale value while refresh runs
+	// 0     | 1     | refresh already running
+	// 100ms | 2     | refreshed value
+	for idx, tc := range []struct {
+		Delay time.Duration
+		Count int
+	}{
+		{0, 1},
+		{110 * time.Millisecond, 1},
+		{0, 1},
+		{100 * time.Millisecond, 2},
+	} {
+		<-time.After(tc.Delay)
+		start := time.Now()
+		data, err := a(r)
+		if err != nil {
+			t.Error(err)
+		} else if data["Count"] != tc.Count {
+			t.Error("test\t", idx, "\texpected:\tCount ", tc.Count, "\tactual:\t", data)
+		}
+		if idx > 0 && time.Since(start) > 25*time.Millisecond {
+			t.Error("test\t", idx, "\tshould not wait on the action:\t", time.Since(start))
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Error("expected:\t2 calls\tactual:\t", n, "calls")
+	}
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	var calls int32
+	stockError := errors.New("Stock Error")
+	r := httptest.NewRequest("GET", "/", nil)
+
+	a := cached(SequenceAction(0, &calls, nil, stockError), 10*time.Millisecond, CachePolicy{
+		StaleIfError: time.Hour,
+	})
+	if data, err := a(r); err != nil || data["Count"] != 1 {
+		t.Error("expected:\tCount 1\tactual:\t", data, err)
+	}
+	<-time.After(20 * time.Millisecond)
+	if data, err := a(r); err != nil || data["Count"] != 1 {
+		t.Error("expected:\tstale Count 1\tactual:\t", data, err)
+	}
+
+	calls = 0
+	a = cached(SequenceAction(0, &calls, nil, stockError), 10*time.Millisecond, CachePolicy{})
+	a(r)
+	<-time.After(20 * time.Millisecond)
+	if _, err := a(r); err != stockError {
+		t.Error("expected:\t", stockError, "\tactual:\t", err)
+	}
+}
+
+// A panicking Action should fail its call with an error, without blocking later calls or,
+// in a background refresh, crashing the server
+func TestCachePanic(t *testing.T) {
+	var calls int32
+	panicky := Action(func(r *http.Request) (map[string]interface{}, error) {
+		if n := atomic.AddInt32(&calls, 1); n%2 == 1 {
+			panic("boom")
+		}
+		return map[string]interface{}{"Count": int(atomic.LoadInt32(&calls))}, nil
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+
+	a := cached(panicky, time.Hour, CachePolicy{})
+	if data, err := a(r); err == nil || data != nil {
+		t.Error("expected:\t", "a panic error", "\tactual:\t", data, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if data, err := a(r); err != nil || data["Count"] != 2 {
+			t.Error("expected:\tCount 2\tactual:\t", data, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected:\t", "the call to finish", "\tactual:\t", "waiting on the panicked call")
+	}
+
+	calls = 1 // the next call succeeds, and the refresh after it panics
+	a = cached(panicky, 10*time.Millisecond, CachePolicy{StaleWhileRevalidate: time.Hour})
+	a(r)
+	<-time.After(20 * time.Millisecond)
+	if data, err := a(r); err != nil || data["Count"] != 2 {
+		t.Error("expected:\tstale Count 2\tactual:\t", data, err)
+	}
+	<-time.After(20 * time.Millisecond) // the refresh panics in the background
+	if data, err := a(r); err != nil || data["Count"] != 2 {
+		t.Error("expected:\tstale Count 2\tactual:\t", data, err)
+	}
+}
+
+// A shared call should not be canceled with the request that started it, and each request
+// should stop waiting when its own context is done
+func TestCacheSharedCallCancel(t *testing.T) {
+	var calls int32
+	a := cached(Action(func(r *http.Request) (map[string]interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return map[string]interface{}{"Count": 1}, nil
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}), time.Hour, CachePolicy{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := a(httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		leader <- err
+	}()
+	<-time.After(10 * time.Millisecond)
+	waiter := make(chan error, 1)
+	go func() {
+		data, err := a(httptest.NewRequest("GET", "/", nil))
+		if err == nil && data["Count"] != 1 {
+			err = fmt.Errorf("Count %v", data["Count"])
+		}
+		waiter <- err
+	}()
+	<-time.After(10 * time.Millisecond)
+	cancel()
+
+	if err := <-leader; err != context.Canceled {
+		t.Error("expected:\t", context.Canceled, "\tactual:\t", err)
+	}
+	if err := <-waiter; err != nil {
+		t.Error("expected:\t", nil, "\tactual:\t", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("expected:\t1 call\tactual:\t", n, "calls")
+	}
+}
+
+// Under the default policy a cached Action must not see the session, or one client's data
+// would be shared with everyone; a Key varying on the session cookie lets it
+func TestCacheSession(t *testing.T) {
+	m, err := sessions.New([][]byte{[]byte("key")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessions.From(r.Context()).Set("user", "alice")
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	user := Action(func(r *http.Request) (map[string]interface{}, error) {
+		return map[string]interface{}{"User": sessions.From(r.Context()).Get("user")}, nil
+	})
+
+	// policy           | USER
+	// default          | ""
+	// session cookie   | alice
+	type testCase struct {
+		Policy CachePolicy
+		User   string
+	}
+	testCases := []testCase{
+		{CachePolicy{}, ""},
+		{CachePolicy{Key: VaryCacheKey(nil, []string{sessions.DefaultName})}, "alice"},
+	}
+	for idx, tc := range testCases {
+		a := cached(user, time.Hour, tc.Policy)
+		req := httptest.NewRequest("GET", "/", nil)
+		for _, c := range w.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		var data map[string]interface{}
+		m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, err = a(r)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+		if err != nil || data["User"] != tc.User {
+			t.Error("test\t", idx, "\texpected:\t", tc.User, "\tactual:\t", data, err)
+		}
+	}
+}
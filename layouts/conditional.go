@@ -0,0 +1,63 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// An Action may set this key to a time.Time to have Act send it as the Last-Modified
+// header and honor If-Modified-Since against it.
+// Data from a TypedAction does the same by implementing LastModified() time.Time.
+const LastModifiedKey = "LastModified"
+
+// lastModified finds when data was last modified, or returns the zero time.
+func lastModified(data interface{}) time.Time {
+	switch d := data.(type) {
+	case map[string]interface{}:
+		t, _ := d[LastModifiedKey].(time.Time)
+		return t
+	case interface{ LastModified() time.Time }:
+		return d.LastModified()
+	}
+	return time.Time{}
+}
+
+// etag returns a strong entity tag for a rendered page.
+func etag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified reports whether the request's validators show the client already
+// has the current representation. If-None-Match takes precedence over If-Modified-Since.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// etagMatch uses the weak comparison required for If-None-Match, so a tag
+// weakened along the way (e.g. by compression) still matches.
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
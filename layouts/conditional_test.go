@@ -0,0 +1,76 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ModifiedAction(modified time.Time) Action {
+	return Action(func(r *http.Request) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"Count":         1,
+			LastModifiedKey: modified,
+		}, nil
+	})
+}
+
+func TestActConditional(t *testing.T) {
+	l, err := New(nil, "base", ".test/base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2016, time.March, 31, 12, 0, 0, 0, time.UTC)
+	h := l.Act(ModifiedAction(modified), nil, ExtremeVolatility)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	tag := w.Header().Get("ETag")
+	if w.Code != 200 || len(tag) == 0 {
+		t.Fatal("expected:\tstatus 200 with ETag\tactual:\tstatus ", w.Code, "ETag", tag)
+	}
+	if lm := w.Header().Get("Last-Modified"); lm != modified.Format(http.TimeFormat) {
+		t.Error("expected:\tLast-Modified:", modified.Format(http.TimeFormat), "\tactual:\tLast-Modified:", lm)
+	}
+
+	// Header            | Value                 | Status
+	// ------------------|-----------------------|-------
+	// If-None-Match     | tag                   | 304
+	// If-None-Match     | W/tag                 | 304
+	// If-None-Match     | "other", tag          | 304
+	// If-None-Match     | *                     | 304
+	// If-None-Match     | "other"               | 200
+	// If-Modified-Since | modified              | 304
+	// If-Modified-Since | modified - 1h         | 200
+	// If-Modified-Since | modified + 1h         | 304
+	testCases := []struct {
+		Header string
+		Value  string
+		Status int
+	}{
+		{"If-None-Match", tag, 304},
+		{"If-None-Match", "W/" + tag, 304},
+		{"If-None-Match", `"other", ` + tag, 304},
+		{"If-None-Match", "*", 304},
+		{"If-None-Match", `"other"`, 200},
+		{"If-Modified-Since", modified.Format(http.TimeFormat), 304},
+		{"If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat), 200},
+		{"If-Modified-Since", modified.Add(time.Hour).Format(http.TimeFormat), 304},
+	}
+	for idx, tc := range testCases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(tc.Header, tc.Value)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.Status {
+			t.Error("test\t", idx, "\texpected:\tstatus ", tc.Status, "\tactual:\tstatus ", w.Code)
+		}
+		if w.Code == 304 && w.Body.Len() != 0 {
+			t.Error("test\t", idx, "\texpected:\tempty body\tactual:\t", w.Body.String())
+		}
+	}
+}
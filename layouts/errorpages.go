@@ -0,0 +1,156 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/lazyengineering/gobase/middleware"
+)
+
+// ErrorPages renders error responses through a Layout, so that they share its base
+// template. Templates for the pages live in one folder and are named for the status
+// they cover: a response uses the first found of "404.html", "4xx.html", and
+// "error.html" (for a 404), each parsed with the Layout's patterns like a handler's
+// templates. If rendering fails, a plain built-in page is used instead.
+type ErrorPages struct {
+	layout *Layout
+	data   Action
+	stores map[string]*templateStore // by file name
+}
+
+// Create ErrorPages from the templates in dir. The data Action, which may be nil,
+// supplies data every page on the site needs (e.g. navigation); error pages add
+// Title, Status, StatusText, Message, and RequestID to it.
+func (l *Layout) ErrorPages(dir string, data Action) (*ErrorPages, error) {
+	p := &ErrorPages{
+		layout: l,
+		data:   data,
+		stores: make(map[string]*templateStore),
+	}
+	matches, err := l.glob(path.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		s := l.store(-1, Options{}, []string{m})
+		if !l.LazyLoad {
+			// ensure that template loading will work
+			if _, err := s.get(context.Background()); err != nil {
+				return nil, err
+			}
+		}
+		p.stores[path.Base(m)] = s
+	}
+	return p, nil
+}
+
+// Handler returns an ErrorHandler that renders the page for the error's StatusCode.
+func (p *ErrorPages) Handler() ErrorHandler {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		p.Render(w, r, StatusCode(err), err)
+	}
+}
+
+// Render logs the error and responds with the page for the status. The page shows the
+// error's PublicMessage, or the status text when err is nil. A status that isn't a 4xx or
+// 5xx is rendered as a 500.
+func (p *ErrorPages) Render(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if !errorStatus(status) {
+		status = http.StatusInternalServerError
+	}
+	// the page shows the request ID, so make sure there is one to find in the log
+	id := middleware.RequestIDFrom(r.Context())
+	if len(id) == 0 {
+		id = middleware.NewRequestID()
+		r = r.WithContext(middleware.WithRequestID(r.Context(), id))
+	}
+	tag := middleware.RequestTag(r.Context())
+	if err != nil {
+		log.Printf("\x1b[1;31m%s:\x1b[0m %s%s %v", http.StatusText(status), tag, r.URL.String(), err)
+	} else {
+		log.Printf("\x1b[1;31m%s:\x1b[0m %s%s", http.StatusText(status), tag, r.URL.String())
+	}
+
+	data := make(map[string]interface{})
+	if p.data != nil {
+		if d, derr := p.data(r); derr == nil {
+			for k, v := range d {
+				data[k] = v
+			}
+		}
+	}
+	message := http.StatusText(status)
+	if err != nil {
+		message = PublicMessage(err)
+	}
+	data["Title"] = fmt.Sprintf("%d – %s", status, http.StatusText(status))
+	data["Status"] = status
+	data["StatusText"] = http.StatusText(status)
+	data["Message"] = message
+	data["RequestID"] = id
+
+	b := new(bytes.Buffer)
+	unique, rerr := p.render(r, b, status, data)
+	if rerr != nil {
+		log.Printf("\x1b[1;31mError Page:\x1b[0m %s%s %d %v", tag, r.URL.String(), status, rerr)
+		b.Reset()
+		fallbackErrorPage.Execute(b, data)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if unique {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Del("ETag")
+	w.Header().Del("Last-Modified")
+	w.WriteHeader(status)
+	b.WriteTo(w)
+}
+
+// render executes the most specific template for the status, reporting whether the page is
+// unique to the request (see Layout.bind).
+func (p *ErrorPages) render(r *http.Request, b *bytes.Buffer, status int, data map[string]interface{}) (bool, error) {
+	for _, name := range []string{
+		strconv.Itoa(status) + ".html",
+		strconv.Itoa(status/100) + "xx.html",
+		"error.html",
+	} {
+		s, ok := p.stores[name]
+		if !ok {
+			continue
+		}
+		t, err := s.get(r.Context())
+		if err != nil {
+			return false, err
+		}
+		t, unique := p.layout.bind(t, r)
+		err = t.ExecuteTemplate(b, s.base, data)
+		return unique(), err
+	}
+	return false, fmt.Errorf("layouts: no error page template for %d", status)
+}
+
+// The page rendered when an error page template is missing or fails
+var fallbackErrorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+</head>
+<body>
+  <h1>{{.Status}}</h1>
+  <p>{{.Message}}</p>
+  <p><small>Request ID: {{.RequestID}}</small></p>
+</body>
+</html>
+`))
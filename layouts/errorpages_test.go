@@ -0,0 +1,147 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lazyengineering/gobase/middleware"
+)
+
+func TestErrorPages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html":  {Data: []byte(`{{define "base"}}[{{.Site}}]{{template "body" .}}{{end}}`)},
+		"errors/404.html":    {Data: []byte(`{{define "body"}}missing {{.Status}} {{.Message}}{{end}}`)},
+		"errors/4xx.html":    {Data: []byte(`{{define "body"}}client {{.Status}} {{.Message}}{{end}}`)},
+		"errors/error.html":  {Data: []byte(`{{define "body"}}error {{.Status}} {{.Message}} {{.RequestID}}{{end}}`)},
+		"errors/broken.html": {Data: []byte(`{{define "other"}}{{end}}`)},
+	}
+	l, err := NewFS(fsys, nil, "base", "layouts/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := func(*http.Request) (map[string]interface{}, error) {
+		return map[string]interface{}{"Site": "gobase"}, nil
+	}
+	p, err := l.ErrorPages("errors", site)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/*
+		| status | err                           | request id | body                               |
+		|--------|-------------------------------|------------|------------------------------------|
+		| 404    | nil                           | -          | exact template, status text        |
+		| 403    | nil                           | -          | class template                     |
+		| 500    | plain error                   | abc        | error.html, message hidden         |
+		| 403    | Error with a public message   | -          | class template, message shown      |
+		| 0      | nil                           | abc        | error.html as a 500                |
+		| 302    | nil                           | abc        | error.html as a 500                |
+	*/
+	type testCase struct {
+		Status   int
+		Err      error
+		ID       string
+		Code     int
+		Expected string
+	}
+	testCases := []testCase{
+		{404, nil, "", 404, "[gobase]missing 404 Not Found"},
+		{403, nil, "", 403, "[gobase]client 403 Forbidden"},
+		{500, errors.New("database password is hunter2"), "abc", 500, "[gobase]error 500 Internal Server Error abc"},
+		{403, StatusError(http.StatusForbidden, "Members only", nil), "", 403, "[gobase]client 403 Members only"},
+		{0, nil, "abc", 500, "[gobase]error 500 Internal Server Error abc"},
+		{302, nil, "abc", 500, "[gobase]error 500 Internal Server Error abc"},
+	}
+	for idx, tc := range testCases {
+		req := httptest.NewRequest("GET", "/page", nil)
+		if len(tc.ID) > 0 {
+			req.Header.Set("X-Request-ID", tc.ID)
+		}
+		res := httptest.NewRecorder()
+		middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.Render(w, r, tc.Status, tc.Err)
+		})).ServeHTTP(res, req)
+		if res.Code != tc.Code {
+			t.Error("test\t", idx, "\texpected:\t", tc.Code, "\tactual:\t", res.Code)
+		}
+		if actual := res.Body.String(); actual != tc.Expected {
+			t.Error("test\t", idx, "\texpected:\t", tc.Expected, "\tactual:\t", actual)
+		}
+		if cc := res.Header().Get("Cache-Control"); cc != "no-cache" {
+			t.Error("test\t", idx, "\texpected:\t", "no-cache", "\tactual:\t", cc)
+		}
+	}
+}
+
+func TestErrorPagesFallback(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`{{define "base"}}{{template "body" .}}{{end}}`)},
+		"errors/404.html":   {Data: []byte(`{{define "body"}}missing{{end}}`)},
+	}
+	l, err := NewFS(fsys, nil, "base", "layouts/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := l.ErrorPages("errors", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/page", nil)
+	req.Header.Set("X-Request-ID", "xyz")
+	res := httptest.NewRecorder()
+	middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.Handler()(w, r, ErrTimeout)
+	})).ServeHTTP(res, req)
+	if res.Code != http.StatusServiceUnavailable {
+		t.Error("expected:\t", http.StatusServiceUnavailable, "\tactual:\t", res.Code)
+	}
+	body := res.Body.String()
+	for _, s := range []string{"<h1>503</h1>", "Request ID: xyz"} {
+		if !strings.Contains(body, s) {
+			t.Error("expected:\t", s, "\tactual:\t", body)
+		}
+	}
+}
+
+// The log line for an error page should carry the request ID shown on the page, and no
+// error when there is none
+func TestErrorPagesLog(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`{{define "base"}}{{template "body" .}}{{end}}`)},
+		"errors/error.html": {Data: []byte(`{{define "body"}}{{.RequestID}}{{end}}`)},
+	}
+	l, err := NewFS(fsys, nil, "base", "layouts/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := l.ErrorPages("errors", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	log.SetOutput(b)
+	defer log.SetOutput(os.Stderr)
+
+	res := httptest.NewRecorder()
+	p.Render(res, httptest.NewRequest("GET", "/nope", nil), http.StatusNotFound, nil)
+	line := b.String()
+	if !strings.Contains(line, "["+res.Body.String()+"] /nope") || strings.Contains(line, "<nil>") {
+		t.Error("expected:\t", "["+res.Body.String()+"] /nope", "\tactual:\t", line)
+	}
+
+	b.Reset()
+	p.Render(httptest.NewRecorder(), httptest.NewRequest("GET", "/broken", nil), http.StatusInternalServerError, errors.New("Stock Error"))
+	if line := b.String(); !strings.HasSuffix(line, "/broken Stock Error\n") {
+		t.Error("expected:\t", "/broken Stock Error", "\tactual:\t", line)
+	}
+}
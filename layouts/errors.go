@@ -3,6 +3,11 @@
 
 package layouts
 
+import (
+	"errors"
+	"net/http"
+)
+
 // simple error to eliminate the need for the errors package
 type layoutError string
 
@@ -12,5 +17,108 @@ func (e layoutError) Error() string {
 
 // Error Messages used in this package
 const (
-	errNoBaseTemplate layoutError = "layouts: baseTemplate required but not provided"
+	errNoBaseTemplate  layoutError = "layouts: baseTemplate required but not provided"
+	errActionsCanceled layoutError = "layouts: actions canceled"
+)
+
+// Errors that may be passed to an ErrorHandler
+const (
+	ErrTimeout layoutError = "layouts: action deadline exceeded"
 )
+
+// An Error is an error that knows how it should be answered over HTTP. Actions may
+// return one (or wrap one) to have a response other than 500 Internal Server Error:
+// Act redirects 3xx Errors with a Location itself, and passes the others along to
+// the ErrorHandler, which can find their status with StatusCode.
+type Error struct {
+	Status   int    // HTTP status code
+	Message  string // safe to show to the client; defaults to the status text
+	Cause    error  // the internal cause, for logs only
+	Location string // redirect target, for 3xx statuses
+}
+
+func (e *Error) Error() string {
+	msg := "layouts: " + http.StatusText(e.Status)
+	if len(e.Message) > 0 {
+		msg += ": " + e.Message
+	}
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// PublicMessage returns the message that is safe to show to the client.
+func (e *Error) PublicMessage() string {
+	if len(e.Message) > 0 {
+		return e.Message
+	}
+	return http.StatusText(StatusCode(e))
+}
+
+// Returns an Error with the status, public message, and internal cause.
+func StatusError(status int, message string, cause error) *Error {
+	return &Error{Status: status, Message: message, Cause: cause}
+}
+
+// Returns a 404 Not Found Error with the internal cause.
+func NotFound(cause error) *Error {
+	return &Error{Status: http.StatusNotFound, Cause: cause}
+}
+
+// Returns a 403 Forbidden Error with the internal cause.
+func Forbidden(cause error) *Error {
+	return &Error{Status: http.StatusForbidden, Cause: cause}
+}
+
+// Returns an Error that redirects to location with the 3xx status.
+func Redirect(location string, status int) *Error {
+	return &Error{Status: status, Location: location}
+}
+
+// StatusCode returns the HTTP status an error should be answered with: the Status of an
+// Error, 503 Service Unavailable for ErrTimeout, or 500 Internal Server Error otherwise.
+// An Error's Status must be a 4xx or 5xx, or a 3xx with a Location, or it is a 500 too.
+func StatusCode(err error) int {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		if errorStatus(e.Status) || e.Status >= 300 && e.Status < 400 && len(e.Location) > 0 {
+			return e.Status
+		}
+	case errors.Is(err, ErrTimeout):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// errorStatus reports whether status can be answered with an error page
+func errorStatus(status int) bool {
+	return status >= 400 && status < 600
+}
+
+// PublicMessage returns the message about an error that is safe to show to the client:
+// the message of an Error, or else the text of its status.
+func PublicMessage(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.PublicMessage()
+	}
+	return http.StatusText(StatusCode(err))
+}
+
+// redirecting wraps an ErrorHandler to answer 3xx Errors with a redirect.
+func redirecting(eh ErrorHandler) ErrorHandler {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		var e *Error
+		if errors.As(err, &e) && e.Status >= 300 && e.Status < 400 && len(e.Location) > 0 {
+			http.Redirect(w, r, e.Location, e.Status)
+			return
+		}
+		eh(w, r, err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusCode(t *testing.T) {
+	stock := errors.New("Stock Error")
+	testCases := []struct {
+		Err     error
+		Status  int
+		Message string
+	}{
+		{stock, 500, "Internal Server Error"},
+		{ErrTimeout, 503, "Service Unavailable"},
+		{NotFound(stock), 404, "Not Found"},
+		{Forbidden(nil), 403, "Forbidden"},
+		{StatusError(400, "Missing name", stock), 400, "Missing name"},
+		{fmt.Errorf("wrapped: %w", NotFound(stock)), 404, "Not Found"},
+		{Redirect("/elsewhere", 302), 302, "Found"},
+		{&Error{Status: 302}, 500, "Internal Server Error"},
+		{&Error{}, 500, "Internal Server Error"},
+		{StatusError(200, "OK", stock), 500, "OK"},
+		{StatusError(700, "", stock), 500, "Internal Server Error"},
+	}
+	for idx, tc := range testCases {
+		if s := StatusCode(tc.Err); s != tc.Status {
+			t.Error("test\t", idx, "\texpected:\t", tc.Status, "\tactual:\t", s)
+		}
+		if m := PublicMessage(tc.Err); m != tc.Message {
+			t.Error("test\t", idx, "\texpected:\t", tc.Message, "\tactual:\t", m)
+		}
+	}
+	if !errors.Is(NotFound(stock), stock) {
+		t.Error("expected:\tcause to unwrap\tactual:\tnot unwrapped")
+	}
+}
+
+func StatusErrorAction(err error) Action {
+	return Action(func(r *http.Request) (map[string]interface{}, error) {
+		return nil, err
+	})
+}
+
+func TestActError(t *testing.T) {
+	l, err := New(nil, "base", ".test/base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eh := ErrorHandler(func(w http.ResponseWriter, r *http.Request, e error) {
+		http.Error(w, PublicMessage(e), StatusCode(e))
+	})
+
+	testCases := []struct {
+		Err      error
+		Status   int
+		Location string
+	}{
+		{NotFound(nil), 404, ""},
+		{Forbidden(nil), 403, ""},
+		{Redirect("/elsewhere", http.StatusSeeOther), 303, "/elsewhere"},
+		{errors.New("Stock Error"), 500, ""},
+	}
+	for idx, tc := range testCases {
+		w := httptest.NewRecorder()
+		l.Act(StatusErrorAction(tc.Err), eh, ExtremeVolatility).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != tc.Status {
+			t.Error("test\t", idx, "\texpected:\tstatus ", tc.Status, "\tactual:\tstatus ", w.Code)
+		}
+		if loc := w.Header().Get("Location"); loc != tc.Location {
+			t.Error("test\t", idx, "\texpected:\tLocation:", tc.Location, "\tactual:\tLocation:", loc)
+		}
+	}
+}
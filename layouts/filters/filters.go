@@ -5,8 +5,13 @@
 package filters
 
 import (
+	"github.com/lazyengineering/gobase/layouts"
+	"github.com/lazyengineering/gobase/middleware"
+	"github.com/lazyengineering/gobase/sessions"
 	"github.com/russross/blackfriday"
+	"html"
 	"html/template"
+	"net/http"
 	"strings"
 )
 
@@ -25,9 +30,134 @@ func CloakEmail(email, at string) template.HTML {
 	return template.HTML(strings.Replace(email, "@", at, -1))
 }
 
+// AssetPath returns the path to use for a static asset, named relative to the static
+// folder (e.g. "css/main.css"). Set it to assets.Manifest.Path to use fingerprinted paths;
+// by default it returns the plain path.
+var AssetPath = func(name string) string {
+	return "/" + strings.TrimPrefix(name, "/")
+}
+
+// Calls AssetPath for use in templates, as {{asset "css/main.css"}}
+func Asset(name string) string {
+	return AssetPath(name)
+}
+
+// AssetIntegrity returns the Subresource Integrity hash of a static asset, named as for
+// AssetPath, or "" when it is unknown. Set it to assets.Manifest.Integrity; by default it
+// always returns "".
+var AssetIntegrity = func(name string) string {
+	return ""
+}
+
+// Vendored maps static assets that are copies of files on a CDN, named as for AssetPath,
+// to the URLs of the CDN's copies. Script and Stylesheet link to the CDN's copy, checked
+// against the hash of the local copy, unless VendorLocally is set.
+var Vendored = map[string]string{}
+
+// VendorLocally serves vendored assets from the site instead of a CDN, e.g. for
+// offline or locked-down deployments.
+var VendorLocally bool
+
+// Creates a <script> tag for a static asset, as {{script "js/vendor/jquery.min.js"}}.
+// See Vendored.
+func Script(name string) template.HTML {
+	src, integrity := vendored(name)
+	return template.HTML(`<script src="` + src + `"` + integrity + `></script>`)
+}
+
+// Creates a stylesheet <link> tag for a static asset, as {{stylesheet "css/main.css"}}.
+// See Vendored.
+func Stylesheet(name string) template.HTML {
+	href, integrity := vendored(name)
+	return template.HTML(`<link rel="stylesheet" href="` + href + `"` + integrity + `>`)
+}
+
+// vendored returns the escaped URL for an asset, and its integrity attributes if known
+func vendored(name string) (string, string) {
+	u, cdn := Vendored[name]
+	if !cdn || VendorLocally {
+		u = AssetPath(name)
+	}
+	var attrs string
+	if i := AssetIntegrity(name); len(i) > 0 {
+		attrs = ` integrity="` + html.EscapeString(i) + `"`
+		if cdn && !VendorLocally {
+			attrs += ` crossorigin="anonymous"`
+		}
+	}
+	return html.EscapeString(u), attrs
+}
+
+// Returns the request's Content-Security-Policy nonce, for inline scripts as
+// <script nonce="{{cspNonce}}">. It is "" outside of a request; see Request.
+func CSPNonce() string {
+	return ""
+}
+
+// Returns a hidden form field with the request's CSRF token, as {{csrfField}} in a <form>.
+// It is empty outside of a request; see Request and middleware.CSRF.
+func CSRFField() template.HTML {
+	return ""
+}
+
+// Returns the request's CSRF token, e.g. for scripts to send in an X-CSRF-Token header.
+// It is "" outside of a request; see Request and middleware.CSRF.
+func CSRFToken() string {
+	return ""
+}
+
+// Returns the flash messages for the request's session, removing them so each is shown once.
+// It is empty outside of a request; see Request and sessions.Manager.
+func Flashes() []sessions.Flash {
+	return nil
+}
+
+// Request returns the Filters bound to a request, for layouts.Layout.RequestFuncs. Each marks
+// the page layouts.Unique only when it returns something, so that pages without a nonce, a
+// token, or flashes can still be cached.
+func Request(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"cspNonce": func() string {
+			return unique(r, middleware.NonceFrom(r.Context()))
+		},
+		"csrfField": func() template.HTML {
+			token := unique(r, middleware.CSRFToken(r.Context()))
+			if len(token) == 0 {
+				return ""
+			}
+			return template.HTML(`<input type="hidden" name="` + middleware.CSRFFieldName + `" value="` + html.EscapeString(token) + `">`)
+		},
+		"csrfToken": func() string {
+			return unique(r, middleware.CSRFToken(r.Context()))
+		},
+		"flashes": func() []sessions.Flash {
+			flashes := sessions.From(r.Context()).Flashes()
+			if len(flashes) > 0 {
+				layouts.Unique(r)
+			}
+			return flashes
+		},
+	}
+}
+
+// unique marks the page for r unique to it when s is not empty, returning s
+func unique(r *http.Request, s string) string {
+	if len(s) > 0 {
+		layouts.Unique(r)
+	}
+	return s
+}
+
 // All available Filters
 var All = template.FuncMap{
 	"markdownCommon": MarkdownCommon,
 	"markdownBasic":  MarkdownBasic,
 	"cloakEmail":     CloakEmail,
+	"asset":          Asset,
+	"script":         Script,
+	"stylesheet":     Stylesheet,
+	"cspNonce":       CSPNonce,
+	"csrfField":      CSRFField,
+	"csrfToken":      CSRFToken,
+	"flashes":        Flashes,
 }
@@ -4,7 +4,15 @@
 package filters
 
 import (
+	"github.com/lazyengineering/gobase/layouts"
+	"github.com/lazyengineering/gobase/middleware"
+	"github.com/lazyengineering/gobase/sessions"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func TestMarkdownCommon(t *testing.T) {
@@ -73,3 +81,146 @@ func TestCloakEmail(t *testing.T) {
 		t.Error("expected:\t", expected, "\nactual:\t", actual)
 	}
 }
+
+func TestAsset(t *testing.T) {
+	const expected = "/css/main.css"
+	if actual := Asset("css/main.css"); actual != expected {
+		t.Error("expected:\t", expected, "\nactual:\t", actual)
+	}
+
+	defer func(p func(string) string) { AssetPath = p }(AssetPath)
+	AssetPath = func(name string) string { return "/fingerprinted/" + name }
+	if actual := Asset("css/main.css"); actual != "/fingerprinted/css/main.css" {
+		t.Error("expected:\t", "/fingerprinted/css/main.css", "\nactual:\t", actual)
+	}
+}
+
+func TestScriptAndStylesheet(t *testing.T) {
+	defer func(p, i func(string) string, v map[string]string, l bool) {
+		AssetPath, AssetIntegrity, Vendored, VendorLocally = p, i, v, l
+	}(AssetPath, AssetIntegrity, Vendored, VendorLocally)
+	AssetPath = func(name string) string { return "/fp/" + name }
+	AssetIntegrity = func(name string) string {
+		if name == "js/lib.js" || name == "css/lib.css" {
+			return "sha384-abc"
+		}
+		return ""
+	}
+	Vendored = map[string]string{
+		"js/lib.js":   "https://cdn.example.com/lib.js",
+		"css/lib.css": "https://cdn.example.com/lib.css?v=1&min",
+	}
+
+	/*
+		| filter     | name        | local | EXPECTED                                                  |
+		|------------|-------------|-------|-----------------------------------------------------------|
+		| script     | js/lib.js   | no    | CDN src, integrity, crossorigin                           |
+		| script     | js/lib.js   | yes   | local src, integrity                                      |
+		| script     | js/main.js  | no    | local src                                                 |
+		| stylesheet | css/lib.css | no    | CDN href (escaped), integrity, crossorigin                |
+	*/
+	type testCase struct {
+		Filter   func(string) template.HTML
+		Name     string
+		Local    bool
+		Expected string
+	}
+	testCases := []testCase{
+		{Script, "js/lib.js", false, `<script src="https://cdn.example.com/lib.js" integrity="sha384-abc" crossorigin="anonymous"></script>`},
+		{Script, "js/lib.js", true, `<script src="/fp/js/lib.js" integrity="sha384-abc"></script>`},
+		{Script, "js/main.js", false, `<script src="/fp/js/main.js"></script>`},
+		{Stylesheet, "css/lib.css", false, `<link rel="stylesheet" href="https://cdn.example.com/lib.css?v=1&amp;min" integrity="sha384-abc" crossorigin="anonymous">`},
+	}
+	for idx, tc := range testCases {
+		VendorLocally = tc.Local
+		if actual := tc.Filter(tc.Name); string(actual) != tc.Expected {
+			t.Error("test\t", idx, "\texpected:\t", tc.Expected, "\nactual:\t", actual)
+		}
+	}
+}
+
+func TestRequest(t *testing.T) {
+	if actual := CSPNonce(); actual != "" {
+		t.Error("expected:\t", "", "\nactual:\t", actual)
+	}
+	var nonce string
+	middleware.SecureHeaders(middleware.DefaultSecurityPolicy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = Request(r)["cspNonce"].(func() string)()
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if len(nonce) == 0 {
+		t.Error("expected:\t", "a nonce", "\nactual:\t", nonce)
+	}
+}
+
+func TestRequestCSRF(t *testing.T) {
+	if actual := CSRFField(); actual != "" {
+		t.Error("expected:\t", "", "\nactual:\t", actual)
+	}
+	var field template.HTML
+	middleware.CSRF([]byte("key"), nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		field = Request(r)["csrfField"].(func() template.HTML)()
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !strings.HasPrefix(string(field), `<input type="hidden" name="csrf_token" value="`) {
+		t.Error("expected:\t", "a hidden csrf_token field", "\nactual:\t", field)
+	}
+
+	field = Request(httptest.NewRequest("GET", "/", nil))["csrfField"].(func() template.HTML)()
+	if field != "" {
+		t.Error("expected:\t", "", "\nactual:\t", field)
+	}
+}
+
+func TestRequestFlashes(t *testing.T) {
+	if actual := Flashes(); actual != nil {
+		t.Error("expected:\t", nil, "\nactual:\t", actual)
+	}
+	m, err := sessions.New([][]byte{[]byte("key")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flashes []sessions.Flash
+	m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessions.From(r.Context()).AddFlash("info", "hello")
+		flashes = Request(r)["flashes"].(func() []sessions.Flash)()
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if len(flashes) != 1 || flashes[0] != (sessions.Flash{Kind: "info", Message: "hello"}) {
+		t.Error("expected:\t", []sessions.Flash{{Kind: "info", Message: "hello"}}, "\nactual:\t", flashes)
+	}
+
+	flashes = Request(httptest.NewRequest("GET", "/", nil))["flashes"].(func() []sessions.Flash)()
+	if flashes != nil {
+		t.Error("expected:\t", nil, "\nactual:\t", flashes)
+	}
+}
+
+// A page calling the request's Filters is only kept out of caches when they return something
+func TestRequestUnique(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.html": {Data: []byte(`{{define "base"}}{{cspNonce}}{{range flashes}}{{.Message}}{{end}}{{end}}`)},
+	}
+	l, err := layouts.NewFS(fsys, All, "base", "base.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.RequestFuncs = Request
+	page := l.Act(func(*http.Request) (map[string]interface{}, error) { return nil, nil }, nil, layouts.NoVolatility)
+
+	// handler        | CACHE-CONTROL
+	// page           | public, max-age=604800
+	// SecureHeaders  | no-store
+	type testCase struct {
+		Handler      http.Handler
+		CacheControl string
+	}
+	testCases := []testCase{
+		{page, "public, max-age=604800"},
+		{middleware.SecureHeaders(middleware.DefaultSecurityPolicy, page), "no-store"},
+	}
+	for idx, tc := range testCases {
+		w := httptest.NewRecorder()
+		tc.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if cc := w.Header().Get("Cache-Control"); cc != tc.CacheControl {
+			t.Error("test\t", idx, "\texpected:\t", tc.CacheControl, "\nactual:\t", cc)
+		}
+	}
+}
@@ -5,12 +5,20 @@ package layouts
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/lazyengineering/gobase/middleware"
 )
 
 type Volatility uint
@@ -26,9 +34,32 @@ const (
 // Layout defines a collection of templates we can use throughout a site,
 // including the "default" template that we execute.
 type Layout struct {
+	fsys         fs.FS // nil to use the OS filesystem
 	patterns     []string
 	functions    template.FuncMap
 	baseTemplate string
+
+	lock   sync.Mutex
+	stores []*templateStore // the stored templates for each handler, for Watch and Validate
+
+	// Cache determines how data from Actions is cached for handlers created by Act.
+	// The zero value caches per method, path, and query using DefaultCacheKey, and hides
+	// the visitor's session from cached Actions; to read it below ExtremeVolatility, set
+	// a Key such as VaryCacheKey(nil, []string{"session"}).
+	Cache CachePolicy
+
+	// LazyLoad, when true, stops Act from loading (and panicking on) each handler's templates
+	// as it is created, so that Validate can report every problem at once instead.
+	LazyLoad bool
+
+	// RequestFuncs, when set, returns functions bound to a request, such as one for the
+	// request's CSP nonce, which replace functions of the same names for that request.
+	// Templates are parsed before there is a request, so each name must also be among the
+	// Layout's functions, e.g. as a placeholder. A function that returns something specific
+	// to the request or visitor must call Unique with the request it was bound to, so that
+	// the page is not cached; every streamed page is treated as unique, since its headers go
+	// before any of them are called.
+	RequestFuncs func(*http.Request) template.FuncMap
 }
 
 // The signature for a function that will be used when an error occurs with an Action
@@ -57,32 +88,105 @@ func (l *Layout) Init(functions template.FuncMap, baseTemplate string, patterns
 	return nil
 }
 
+// Create a new Layout like New, except that templates are loaded from fsys
+// (e.g. an embed.FS) instead of the OS filesystem.
+func NewFS(fsys fs.FS, functions template.FuncMap, baseTemplate string, patterns ...string) (*Layout, error) {
+	l := new(Layout)
+	err := l.InitFS(fsys, functions, baseTemplate, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Initialize a layout like Init, except that templates are loaded from fsys
+// (e.g. an embed.FS) instead of the OS filesystem.
+// Patterns follow the syntax of fs.Glob.
+func (l *Layout) InitFS(fsys fs.FS, functions template.FuncMap, baseTemplate string, patterns ...string) error {
+	if err := l.Init(functions, baseTemplate, patterns...); err != nil {
+		return err
+	}
+	l.fsys = fsys
+	return nil
+}
+
 // Use Act in order to create an http.Handler that fills a template with the data from an executed Action
-// or executes the ErrorHandler in case of an error.
+// or executes the ErrorHandler in case of an error, except that an Error with a 3xx status and Location redirects.
+// The Action runs with the request's context, so it is canceled along with the request;
+// use Action.Timeout to give the handler a deadline, which surfaces to the ErrorHandler as ErrTimeout.
+// Responses carry an ETag (and a Last-Modified header when the data sets LastModifiedKey),
+// and requests whose validators match are answered with 304 Not Modified.
+// The time spent loading templates, in the Action, and executing the template is recorded
+// with middleware.RecordPhase, as "template", "action", and "execute".
 func (l *Layout) Act(respond Action, eh ErrorHandler, volatility Volatility, templates ...string) http.Handler {
-	var loadTemplates func() (*template.Template, error)
+	return act(l, Options{}, respond, eh, volatility, templates)
+}
+
+// ActNegotiated creates an http.Handler like Act, except that the Action's data may also be
+// rendered as JSON or XML instead of the template, according to the request's Accept header
+// or a ".json" or ".xml" suffix on its path. Keys listed under PrivateKeysKey are left out.
+func (l *Layout) ActNegotiated(respond Action, eh ErrorHandler, volatility Volatility, templates ...string) http.Handler {
+	return act(l, Options{Negotiate: true}, respond, eh, volatility, templates)
+}
+
+// ActWith creates an http.Handler like Act, adjusted by the Options.
+func (l *Layout) ActWith(opts Options, respond Action, eh ErrorHandler, volatility Volatility, templates ...string) http.Handler {
+	return act(l, opts, respond, eh, volatility, templates)
+}
+
+// Options adjust how a handler renders its page.
+type Options struct {
+	// Negotiate allows the data to be rendered as JSON or XML, as with ActNegotiated.
+	Negotiate bool
+
+	// Base names the template to execute instead of the Layout's base template, so that
+	// e.g. admin or print views can use their own shell. A shell may itself wrap the site
+	// layout, overriding its {{block}}s or templates, as the handler's Helpers and
+	// templates are parsed after the Layout's patterns and may redefine their templates.
+	Base string
+
+	// Funcs adds to, or overrides, the Layout's functions for this handler's templates.
+	Funcs template.FuncMap
+
+	// Helpers are patterns for templates parsed after the Layout's patterns and before
+	// the handler's own, such as the shell named by Base.
+	Helpers []string
+
+	// Stream executes the template directly to the response rather than buffering the whole
+	// page first, flushing after the document's </head> and wherever the template calls
+	// {{flush}}. Streamed pages have no ETag. An error before anything has been sent still
+	// goes to the ErrorHandler; after that, it is logged and an HTML comment marking the
+	// failure ends the page, since the status and headers are already gone.
+	Stream bool
+}
+
+// base returns the name of the template to execute
+func (opts Options) base(l *Layout) string {
+	if len(opts.Base) > 0 {
+		return opts.Base
+	}
+	return l.baseTemplate
+}
+
+// patterns returns the patterns for a handler's templates, after its Helpers
+func (opts Options) patterns(templates []string) []string {
+	return append(append([]string(nil), opts.Helpers...), templates...)
+}
+
+// act creates the handler for Act and its siblings, for any type of data.
+func act[T any](l *Layout, opts Options, respond func(*http.Request) (T, error), eh ErrorHandler, volatility Volatility, templates []string) http.Handler {
+	base := opts.base(l)
+	var loadTemplates func(context.Context) (*template.Template, error)
 	var ttl time.Duration
 	if eh == nil {
 		eh = func(w http.ResponseWriter, r *http.Request, e error) {}
 	}
+	eh = redirecting(eh)
 	switch volatility {
 	case NoVolatility:
 		// Load templates so that we can clone instead of loading every time
-		var storedTemplates *template.Template
-		lock := sync.Mutex{}
-		loadTemplates = func() (*template.Template, error) {
-			var err error
-			lock.Lock()
-			defer lock.Unlock()
-			if storedTemplates == nil {
-				storedTemplates, err = l.load(templates...)
-				if err != nil {
-					return nil, err
-				}
-			}
-			return storedTemplates.Clone()
-		}
-		respond = respond.cache(-1) // cache permanently
+		loadTemplates = l.store(-1, opts, templates).get
+		respond = cached(respond, -1, l.Cache) // cache permanently
 		ttl = 7 * 24 * time.Hour
 	case LowVolatility:
 		ttl = 24 * time.Hour
@@ -96,59 +200,88 @@ func (l *Layout) Act(respond Action, eh ErrorHandler, volatility Volatility, tem
 		if ttl == 0 {
 			ttl = 5 * time.Minute
 		}
-		var storedTemplates *template.Template
-		lock := sync.Mutex{}
-		loadTemplates = func() (*template.Template, error) {
-			var err error
-			// lock to ensure we don't have multiple requests attempting to reload the
-			// templates at the same time
-			lock.Lock()
-			defer lock.Unlock()
-			if storedTemplates == nil {
-				storedTemplates, err = l.load(templates...)
-				if err != nil {
-					return nil, err
-				}
-				time.AfterFunc(ttl, func() {
-					lock.Lock()
-					defer lock.Unlock()
-					storedTemplates = nil
-				})
-			}
-			return storedTemplates.Clone()
-		}
-		respond = respond.cache(ttl)
+		loadTemplates = l.store(ttl, opts, templates).get
+		respond = cached(respond, ttl, l.Cache)
 	case ExtremeVolatility:
 		fallthrough // make this the default value
 	default:
-		loadTemplates = func() (*template.Template, error) {
-			return l.load(templates...)
-		}
+		loadTemplates = l.store(0, opts, templates).get
 	}
 	// ensure that template loading will work
-	template.Must(loadTemplates())
+	if !l.LazyLoad {
+		template.Must(loadTemplates(context.Background()))
+	}
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-		t, err := loadTemplates()
+		ctx := req.Context()
+		start := time.Now()
+		t, err := loadTemplates(ctx)
+		middleware.RecordPhase(ctx, "template", time.Since(start))
 		if err != nil {
 			eh(res, req, err)
 			return
 		}
-		var data map[string]interface{}
+		t, unique := l.bind(t, req)
+		var data T
+		start = time.Now()
 		data, err = respond(req)
+		middleware.RecordPhase(ctx, "action", time.Since(start))
 		if err != nil {
 			eh(res, req, err)
 			return
 		}
 
+		f := formatHTML
+		if opts.Negotiate {
+			f = negotiateFormat(req)
+			res.Header().Add("Vary", "Accept")
+		}
+		if opts.Stream && f == formatHTML {
+			// Add Client-Side caching; the headers go before the page, so a Layout with
+			// RequestFuncs must assume it is unique to the request
+			cacheHeaders(res.Header(), volatility, ttl, l.RequestFuncs != nil)
+			start = time.Now()
+			stream(res, req, t, base, data, eh)
+			middleware.RecordPhase(ctx, "execute", time.Since(start))
+			return
+		}
+
 		b := new(bytes.Buffer)
-		if err = t.ExecuteTemplate(b, l.baseTemplate, data); err != nil {
+		start = time.Now()
+		switch f {
+		case formatJSON:
+			res.Header().Set("Content-Type", "application/json; charset=utf-8")
+			err = json.NewEncoder(b).Encode(exposed(data))
+		case formatXML:
+			res.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			err = encodeXML(b, exposed(data))
+		default:
+			err = t.ExecuteTemplate(b, base, data)
+		}
+		middleware.RecordPhase(ctx, "execute", time.Since(start))
+		if err != nil {
+			res.Header().Del("Content-Type")
 			eh(res, req, err)
 			return
 		}
 		// Add Client-Side caching
-		if volatility < ExtremeVolatility {
-			res.Header().Set("Cache-Control", "public, max-age="+strconv.FormatFloat(ttl.Seconds(), 'f', 0, 64))
-			res.Header().Set("Expires", time.Now().Add(ttl).Format(time.RFC1123))
+		cacheHeaders(res.Header(), volatility, ttl, unique())
+		if unique() {
+			// a validator would let the client reuse a copy rendered for another request
+			if _, err = b.WriteTo(res); err != nil {
+				eh(res, req, err)
+			}
+			return
+		}
+		// Add validators for conditional requests
+		tag := etag(b.Bytes())
+		res.Header().Set("ETag", tag)
+		modified := lastModified(data)
+		if !modified.IsZero() {
+			res.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		}
+		if notModified(req, tag, modified) {
+			res.WriteHeader(http.StatusNotModified)
+			return
 		}
 		if _, err = b.WriteTo(res); err != nil {
 			eh(res, req, err)
@@ -156,17 +289,97 @@ func (l *Layout) Act(respond Action, eh ErrorHandler, volatility Volatility, tem
 	})
 }
 
-func (l *Layout) load(patterns ...string) (*template.Template, error) {
+// cacheHeaders sets the headers for caching a page by clients and proxies for ttl, unless the
+// page is unique to its request (e.g. it has a CSP nonce, a CSRF token, or something from the
+// visitor's session), in which case it must not be stored at all.
+func cacheHeaders(h http.Header, volatility Volatility, ttl time.Duration, unique bool) {
+	switch {
+	case unique:
+		h.Set("Cache-Control", "no-store")
+	case volatility < ExtremeVolatility:
+		h.Set("Cache-Control", "public, max-age="+strconv.FormatFloat(ttl.Seconds(), 'f', 0, 64))
+		h.Set("Expires", time.Now().Add(ttl).Format(time.RFC1123))
+	}
+}
+
+// load parses the Layout's patterns followed by the given patterns, with the
+// Layout's functions and any extra functions, logging with the request ID in ctx.
+func (l *Layout) load(ctx context.Context, extra template.FuncMap, patterns ...string) (*template.Template, error) {
 	t := time.Now()
 	var err error
 	// add some key helper functions to the templates
-	b := template.New("base").Funcs(l.functions)
+	b := template.New("base").Funcs(l.funcs(extra))
 	for _, p := range append(l.patterns, patterns...) {
-		_, err = b.ParseGlob(p)
+		if l.fsys != nil {
+			_, err = b.ParseFS(l.fsys, p)
+		} else {
+			_, err = b.ParseGlob(p)
+		}
 		if err != nil {
 			return nil, err
 		}
 	}
-	log.Printf("\x1b[1;35mTemplates:\x1b[0m \x1b[34m%6d\x1b[0mµs \x1b[33m%v\x1b[0m", time.Since(t).Nanoseconds()/1000, append(l.patterns, patterns...))
+	log.Printf("\x1b[1;35mTemplates:\x1b[0m %s\x1b[34m%6d\x1b[0mµs \x1b[33m%v\x1b[0m", middleware.RequestTag(ctx), time.Since(t).Nanoseconds()/1000, append(l.patterns, patterns...))
 	return b, nil
 }
+
+type uniqueKey struct{}
+
+// Unique marks the page being rendered for r, a request passed to RequestFuncs, as unique to
+// the request, e.g. because it shows a CSP nonce, a CSRF token, or the visitor's session. The
+// page is then sent with "Cache-Control: no-store" and no validators, whatever its Volatility.
+func Unique(r *http.Request) {
+	if unique, ok := r.Context().Value(uniqueKey{}).(*atomic.Bool); ok {
+		unique.Store(true)
+	}
+}
+
+// bind adds the functions from RequestFuncs for req to t, which must not have been executed.
+// The returned function reports whether any of them has called Unique since.
+func (l *Layout) bind(t *template.Template, req *http.Request) (*template.Template, func() bool) {
+	var unique atomic.Bool
+	if l.RequestFuncs == nil {
+		return t, unique.Load
+	}
+	req = req.WithContext(context.WithValue(req.Context(), uniqueKey{}, &unique))
+	return t.Funcs(l.RequestFuncs(req)), unique.Load
+}
+
+// funcs returns the functions available to templates: those built into layouts,
+// overridden by the Layout's own, overridden by any extra functions.
+func (l *Layout) funcs(extra template.FuncMap) template.FuncMap {
+	f := template.FuncMap{
+		"flush": noFlush,
+	}
+	for name, fn := range l.functions {
+		f[name] = fn
+	}
+	for name, fn := range extra {
+		f[name] = fn
+	}
+	return f
+}
+
+// glob matches a pattern against the Layout's filesystem
+func (l *Layout) glob(pattern string) ([]string, error) {
+	if l.fsys != nil {
+		return fs.Glob(l.fsys, pattern)
+	}
+	return filepath.Glob(pattern)
+}
+
+// stat describes a file on the Layout's filesystem
+func (l *Layout) stat(name string) (fs.FileInfo, error) {
+	if l.fsys != nil {
+		return fs.Stat(l.fsys, name)
+	}
+	return os.Stat(name)
+}
+
+// readFile reads a file from the Layout's filesystem
+func (l *Layout) readFile(name string) ([]byte, error) {
+	if l.fsys != nil {
+		return fs.ReadFile(l.fsys, name)
+	}
+	return os.ReadFile(name)
+}
@@ -4,15 +4,21 @@
 package layouts
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"html/template"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
+
+	"github.com/lazyengineering/gobase/sessions"
 )
 
 func TestNew(t *testing.T) {
@@ -39,6 +45,25 @@ func TestInit(t *testing.T) {
 	}
 }
 
+func TestNewFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`{{define "base"}}[{{template "page" .}}]{{end}}`)},
+		"pages/count.html":  {Data: []byte(`{{define "page"}}{{.Count}}{{end}}`)},
+	}
+	if _, err := NewFS(fsys, nil, ""); err != errNoBaseTemplate {
+		t.Error(errNoBaseTemplate)
+	}
+	l, err := NewFS(fsys, nil, "base", "layouts/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	l.Act(CountNilAction(t), nil, NoVolatility, "pages/*.html").ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := strings.TrimSpace(w.Body.String()); body != "[1]" {
+		t.Error("expected:\t[1]\tactual:\t", body)
+	}
+}
+
 func NilNilAction() Action {
 	return Action(func(r *http.Request) (map[string]interface{}, error) {
 		return nil, nil
@@ -1075,3 +1100,262 @@ func TestActMerge(t *testing.T) {
 		}
 	}
 }
+
+func ContextSlowAction(canceled chan<- bool) Action {
+	return ContextAction(func(ctx context.Context, r *http.Request) (map[string]interface{}, error) {
+		select {
+		case <-time.After(time.Second):
+			canceled <- false
+			return map[string]interface{}{"Slow": "Slow"}, nil
+		case <-ctx.Done():
+			canceled <- true
+			return nil, ctx.Err()
+		}
+	}).Action()
+}
+
+func TestMergeActionsCancel(t *testing.T) {
+	canceled := make(chan bool, 1)
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, err := MergeActions(ContextSlowAction(canceled), ErrorAction())(r); err == nil {
+		t.Error("expected:\terror\tactual:\tnil")
+	}
+	select {
+	case c := <-canceled:
+		if !c {
+			t.Error("expected:\tslow action canceled\tactual:\tslow action completed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("slow action never returned")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	l, err := New(nil, "base", ".test/base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handled := make(chan error, 1)
+	eh := ErrorHandler(func(w http.ResponseWriter, r *http.Request, e error) {
+		handled <- e
+		http.Error(w, e.Error(), 504)
+	})
+
+	canceled := make(chan bool, 1)
+	service := httptest.NewServer(l.Act(ContextSlowAction(canceled).Timeout(10*time.Millisecond), eh, ExtremeVolatility))
+	defer service.Close()
+	if r, err := http.Get(service.URL); err != nil {
+		t.Error(err)
+	} else if r.StatusCode != 504 {
+		t.Error("expected:\tstatus 504\tactual:\tstatus ", r.StatusCode)
+	}
+	if e := <-handled; e != ErrTimeout {
+		t.Error("expected:\t", ErrTimeout, "\tactual:\t", e)
+	}
+	if c := <-canceled; !c {
+		t.Error("expected:\tslow action canceled\tactual:\tslow action completed")
+	}
+
+	service = httptest.NewServer(l.Act(CountNilAction(t).Timeout(time.Second), eh, ExtremeVolatility))
+	defer service.Close()
+	if r, err := http.Get(service.URL); err != nil {
+		t.Error(err)
+	} else if r.StatusCode != 200 {
+		t.Error("expected:\tstatus 200\tactual:\tstatus ", r.StatusCode)
+	}
+}
+
+func TestActWith(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/site.html":   {Data: []byte(`{{define "site"}}<main>{{block "content" .}}site{{end}}</main>{{end}}`)},
+		"shells/admin.html":   {Data: []byte(`{{define "admin"}}{{template "site" .}}{{end}}{{define "content"}}admin {{template "page" .}}{{end}}`)},
+		"shells/print.html":   {Data: []byte(`{{define "print"}}<pre>{{template "page" .}}</pre>{{end}}`)},
+		"pages/count.html":    {Data: []byte(`{{define "page"}}{{shout .Count}}{{end}}`)},
+		"pages/override.html": {Data: []byte(`{{define "content"}}page {{.Count}}{{end}}`)},
+	}
+	l, err := NewFS(fsys, template.FuncMap{"shout": func(i int) string { return fmt.Sprint(i, "!") }}, "site", "layouts/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Options                              | Templates      | Body
+	// -------------------------------------|----------------|--------------------
+	// none                                 | override       | <main>page 1</main>
+	// Base admin, Helpers shells           | count          | <main>admin 1!</main>
+	// Base print, Helpers shells, Funcs    | count          | <pre>1?</pre>
+	testCases := []struct {
+		Options   Options
+		Templates []string
+		Body      string
+	}{
+		{Options{}, []string{"pages/override.html"}, "<main>page 1</main>"},
+		{Options{Base: "admin", Helpers: []string{"shells/*.html"}}, []string{"pages/count.html"}, "<main>admin 1!</main>"},
+		{Options{
+			Base:    "print",
+			Helpers: []string{"shells/*.html"},
+			Funcs:   template.FuncMap{"shout": func(i int) string { return fmt.Sprint(i, "?") }},
+		}, []string{"pages/count.html"}, "<pre>1?</pre>"},
+	}
+	for idx, tc := range testCases {
+		w := httptest.NewRecorder()
+		l.ActWith(tc.Options, CountNilAction(t), DefaultError(t), NoVolatility, tc.Templates...).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if body := strings.TrimSpace(w.Body.String()); body != tc.Body {
+			t.Error("test\t", idx, "\texpected:\t", tc.Body, "\tactual:\t", body)
+		}
+	}
+	if err := l.Validate(); err != nil {
+		t.Error("expected:\tnil\tactual:\t", err)
+	}
+}
+
+// Functions from RequestFuncs should be bound to each request, for every Volatility
+func TestRequestFuncs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`{{define "base"}}[{{who}}]{{end}}`)},
+	}
+	l, err := NewFS(fsys, template.FuncMap{"who": func() string { return "nobody" }}, "base", "layouts/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.RequestFuncs = func(r *http.Request) template.FuncMap {
+		return template.FuncMap{"who": func() string { return r.URL.Query().Get("who") }}
+	}
+	for _, v := range []Volatility{NoVolatility, HighVolatility, ExtremeVolatility} {
+		h := l.Act(func(*http.Request) (map[string]interface{}, error) { return nil, nil }, DefaultError(t), v)
+		for _, who := range []string{"alice", "bob"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/?who="+who, nil))
+			if body := w.Body.String(); body != "["+who+"]" {
+				t.Error("volatility\t", v, "\texpected:\t", "["+who+"]", "\tactual:\t", body)
+			}
+		}
+	}
+}
+
+// Pages marked Unique by RequestFuncs must not be stored or validated, while other pages of
+// the same Layout, including those calling RequestFuncs that don't mark them, are cached as usual
+func TestRequestFuncsCaching(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`{{define "base"}}{{template "body" .}}{{end}}`)},
+		"pages/nonce.html":  {Data: []byte(`{{define "body"}}<script nonce="{{nonce}}"></script>{{end}}`)},
+		"pages/static.html": {Data: []byte(`{{define "body"}}static{{end}}`)},
+		"pages/unused.html": {Data: []byte(`{{define "body"}}{{if false}}{{nonce}}{{end}}{{end}}`)},
+		"pages/shared.html": {Data: []byte(`{{define "body"}}{{join "a" "b"}}{{end}}`)},
+	}
+	l, err := NewFS(fsys, template.FuncMap{
+		"nonce": func() string { return "" },
+		"join":  func(s ...string) string { return "" },
+	}, "base", "layouts/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	l.RequestFuncs = func(r *http.Request) template.FuncMap {
+		n++
+		return template.FuncMap{
+			"nonce": func() string {
+				Unique(r)
+				return strconv.Itoa(n)
+			},
+			"join": func(s ...string) string { return strings.Join(s, "+") },
+		}
+	}
+	noop := func(*http.Request) (map[string]interface{}, error) { return nil, nil }
+
+	// page        | CACHE-CONTROL           | ETAG
+	// nonce.html  | no-store                | no
+	// shared.html | public, max-age=604800  | yes
+	// static.html | public, max-age=604800  | yes
+	// unused.html | public, max-age=604800  | yes
+	type testCase struct {
+		Page         string
+		CacheControl string
+		ETag         bool
+	}
+	testCases := []testCase{
+		{"pages/nonce.html", "no-store", false},
+		{"pages/shared.html", "public, max-age=604800", true},
+		{"pages/static.html", "public, max-age=604800", true},
+		{"pages/unused.html", "public, max-age=604800", true},
+	}
+	for idx, tc := range testCases {
+		h := l.Act(noop, DefaultError(t), NoVolatility, tc.Page)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if cc := w.Header().Get("Cache-Control"); cc != tc.CacheControl {
+			t.Error("test\t", idx, "\texpected:\t", tc.CacheControl, "\tactual:\t", cc)
+		}
+		if tag := w.Header().Get("ETag"); (len(tag) > 0) != tc.ETag {
+			t.Error("test\t", idx, "\texpected:\t", tc.ETag, "\tactual:\t", tag)
+		}
+		if !tc.ETag {
+			// a client's copy from an earlier request must not be reused
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("If-None-Match", "*")
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Error("test\t", idx, "\texpected:\t", http.StatusOK, "\tactual:\t", w.Code)
+			}
+		}
+	}
+
+	// a streamed page's headers are sent before it is known whether it is unique
+	h := l.ActWith(Options{Stream: true}, noop, DefaultError(t), NoVolatility, "pages/static.html")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Error("expected:\t", "no-store", "\tactual:\t", cc)
+	}
+}
+
+// A page showing the visitor's session, such as its flashes, must not be stored anywhere,
+// or a cache could show it to other visitors, or replay a flash
+func TestSessionPage(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`{{define "base"}}{{range flashes}}{{.Message}}{{end}}{{end}}`)},
+	}
+	l, err := NewFS(fsys, template.FuncMap{"flashes": func() []sessions.Flash { return nil }}, "base", "layouts/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.RequestFuncs = func(r *http.Request) template.FuncMap {
+		return template.FuncMap{"flashes": func() []sessions.Flash {
+			flashes := sessions.From(r.Context()).Flashes()
+			if len(flashes) > 0 {
+				Unique(r)
+			}
+			return flashes
+		}}
+	}
+	m, err := sessions.New([][]byte{[]byte("key")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := m.Handler(l.Act(func(*http.Request) (map[string]interface{}, error) { return nil, nil }, DefaultError(t), NoVolatility))
+
+	// the flash is added by one request, shown by the next, and gone after that
+	w := httptest.NewRecorder()
+	m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessions.From(r.Context()).AddFlash("success", "Saved")
+	})).ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	for idx, expected := range []string{"Saved", ""} {
+		req := httptest.NewRequest("GET", "/", nil)
+		for _, c := range w.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		w = httptest.NewRecorder()
+		page.ServeHTTP(w, req)
+		if body := w.Body.String(); body != expected {
+			t.Error("test\t", idx, "\texpected:\t", expected, "\tactual:\t", body)
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Error("test\t", idx, "\texpected:\t", "no-store", "\tactual:\t", cc)
+		}
+		// once the flash is gone the page is the same for everyone, but still not stored,
+		// since the response updates the session cookie
+		if tag := w.Header().Get("ETag"); len(expected) > 0 && len(tag) > 0 {
+			t.Error("test\t", idx, "\texpected:\t", "no ETag", "\tactual:\t", tag)
+		}
+	}
+}
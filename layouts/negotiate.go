@@ -0,0 +1,158 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An Action may set this key to a []string of keys in its data that must never be
+// exposed as JSON or XML by ActNegotiated. The key itself is never exposed either.
+const PrivateKeysKey = "PrivateKeys"
+
+// MarkPrivate adds keys to the PrivateKeysKey list of data.
+func MarkPrivate(data map[string]interface{}, keys ...string) {
+	private, _ := data[PrivateKeysKey].([]string)
+	data[PrivateKeysKey] = append(private, keys...)
+}
+
+// public returns a copy of data without its private keys.
+func public(data map[string]interface{}) map[string]interface{} {
+	private, _ := data[PrivateKeysKey].([]string)
+	p := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		p[k] = v
+	}
+	delete(p, PrivateKeysKey)
+	for _, k := range private {
+		delete(p, k)
+	}
+	return p
+}
+
+// exposed returns the data that may be rendered as JSON or XML: maps from an Action
+// without their private keys, or data from a TypedAction as is, leaving it to its
+// encoding struct tags.
+func exposed(data interface{}) interface{} {
+	if m, ok := data.(map[string]interface{}); ok {
+		return public(m)
+	}
+	return data
+}
+
+// A format in which a handler can render an Action's data
+type format int
+
+const (
+	formatHTML format = iota
+	formatJSON
+	formatXML
+)
+
+// The media types of each format, in order of preference when equally acceptable
+var formatTypes = []struct {
+	format format
+	types  []string
+}{
+	{formatHTML, []string{"text/html"}},
+	{formatJSON, []string{"application/json"}},
+	{formatXML, []string{"application/xml", "text/xml"}},
+}
+
+// negotiateFormat chooses a format from the request's path suffix, or else its
+// Accept header, defaulting to HTML.
+func negotiateFormat(r *http.Request) format {
+	switch {
+	case strings.HasSuffix(r.URL.Path, ".json"):
+		return formatJSON
+	case strings.HasSuffix(r.URL.Path, ".xml"):
+		return formatXML
+	}
+	accept := r.Header.Get("Accept")
+	if len(accept) == 0 {
+		return formatHTML
+	}
+	best, bestQ := formatHTML, 0.0
+	for _, ft := range formatTypes {
+		for _, t := range ft.types {
+			if q := quality(accept, t); q > bestQ {
+				best, bestQ = ft.format, q
+			}
+		}
+	}
+	return best
+}
+
+// quality returns the q value the Accept header gives the media type, using
+// the most specific matching range.
+func quality(accept, mediaType string) float64 {
+	q, specificity := 0.0, -1
+	for _, r := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+		s := -1
+		switch {
+		case t == mediaType:
+			s = 2
+		case t == "*/*":
+			s = 0
+		case strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")):
+			s = 1
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, 1
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+	}
+	return q
+}
+
+// encodeXML writes data as XML. Maps are written as a <data> element with a child
+// element for each key, in sorted order.
+func encodeXML(w io.Writer, data interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return xml.NewEncoder(w).Encode(data)
+	}
+	return encodeXMLMap(w, m)
+}
+
+func encodeXMLMap(w io.Writer, data map[string]interface{}) error {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	enc := xml.NewEncoder(w)
+	start := xml.StartElement{Name: xml.Name{Local: "data"}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := enc.EncodeElement(data[k], xml.StartElement{Name: xml.Name{Local: k}}); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeToken(start.End()); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
@@ -0,0 +1,87 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	testCases := []struct {
+		Path   string
+		Accept string
+		Format format
+	}{
+		{"/", "", formatHTML},
+		{"/", "*/*", formatHTML},
+		{"/", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", formatHTML},
+		{"/", "application/json", formatJSON},
+		{"/", "application/json, text/javascript, */*; q=0.01", formatJSON},
+		{"/", "text/xml", formatXML},
+		{"/", "application/*", formatJSON},
+		{"/", "text/html;q=0.5, application/xml", formatXML},
+		{"/", "image/png", formatHTML},
+		{"/page.json", "text/html", formatJSON},
+		{"/page.xml", "", formatXML},
+	}
+	for idx, tc := range testCases {
+		r := httptest.NewRequest("GET", tc.Path, nil)
+		if len(tc.Accept) > 0 {
+			r.Header.Set("Accept", tc.Accept)
+		}
+		if f := negotiateFormat(r); f != tc.Format {
+			t.Error("test\t", idx, "\texpected:\t", tc.Format, "\tactual:\t", f)
+		}
+	}
+}
+
+func PrivateAction() Action {
+	return Action(func(r *http.Request) (map[string]interface{}, error) {
+		data := map[string]interface{}{
+			"Count":  1,
+			"Secret": "hidden",
+		}
+		MarkPrivate(data, "Secret")
+		return data, nil
+	})
+}
+
+func TestActNegotiated(t *testing.T) {
+	l, err := New(nil, "base", ".test/base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := l.ActNegotiated(PrivateAction(), DefaultError(t), NoVolatility)
+
+	testCases := []struct {
+		Accept      string
+		ContentType string
+		Body        string
+	}{
+		{"text/html", "text/plain; charset=utf-8", "1"},
+		{"application/json", "application/json; charset=utf-8", `{"Count":1}`},
+		{"application/xml", "application/xml; charset=utf-8", `<?xml version="1.0" encoding="UTF-8"?>` + "\n<data><Count>1</Count></data>"},
+	}
+	for idx, tc := range testCases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tc.Accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != 200 {
+			t.Error("test\t", idx, "\texpected:\tstatus 200\tactual:\tstatus ", w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tc.ContentType {
+			t.Error("test\t", idx, "\texpected:\tContent-Type:", tc.ContentType, "\tactual:\tContent-Type:", ct)
+		}
+		if v := w.Header().Get("Vary"); v != "Accept" {
+			t.Error("test\t", idx, "\texpected:\tVary: Accept\tactual:\tVary:", v)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != tc.Body {
+			t.Error("test\t", idx, "\texpected:\t", tc.Body, "\tactual:\t", body)
+		}
+	}
+}
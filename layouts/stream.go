@@ -0,0 +1,100 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"bufio"
+	"bytes"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/lazyengineering/gobase/middleware"
+)
+
+// Ends a streamed page whose template failed after part of it was sent
+const streamErrorMarker = "\n<!-- layouts: rendering failed, page incomplete -->\n"
+
+// noFlush stands in for the flush function when a page is not streamed
+func noFlush() template.HTML {
+	return ""
+}
+
+// stream executes the template straight to the response. See Options.Stream.
+func stream(res http.ResponseWriter, req *http.Request, t *template.Template, name string, data interface{}, eh ErrorHandler) {
+	sw := newStreamWriter(res)
+	t.Funcs(template.FuncMap{
+		"flush": func() (template.HTML, error) {
+			return "", sw.Flush()
+		},
+	})
+	if res.Header().Get("Content-Type") == "" {
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	err := t.ExecuteTemplate(sw, name, data)
+	if err == nil {
+		err = sw.Flush()
+	}
+	if err == nil {
+		return
+	}
+	if !sw.out.sent {
+		res.Header().Del("Content-Type")
+		eh(res, req, err)
+		return
+	}
+	log.Printf("\x1b[1;31mStream Error:\x1b[0m %s%s %v", middleware.RequestTag(req.Context()), req.URL.String(), err)
+	io.WriteString(sw, streamErrorMarker)
+	sw.Flush()
+}
+
+// streamWriter buffers writes to the response, flushing the buffer and the
+// response after the document's head.
+type streamWriter struct {
+	res http.ResponseWriter
+	out *sentWriter
+	w   *bufio.Writer
+}
+
+func newStreamWriter(res http.ResponseWriter) *streamWriter {
+	out := &sentWriter{w: res}
+	return &streamWriter{
+		res: res,
+		out: out,
+		w:   bufio.NewWriter(out),
+	}
+}
+
+var endHead = []byte("</head>")
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err == nil && bytes.Contains(p, endHead) {
+		err = s.Flush()
+	}
+	return n, err
+}
+
+// Flush sends everything written so far to the client.
+func (s *streamWriter) Flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if f, ok := s.res.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// sentWriter notes whether anything has been written to the response.
+type sentWriter struct {
+	w    io.Writer
+	sent bool
+}
+
+func (s *sentWriter) Write(p []byte) (int, error) {
+	s.sent = s.sent || len(p) > 0
+	return s.w.Write(p)
+}
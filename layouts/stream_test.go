@@ -0,0 +1,85 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// flushRecorder records what had been written by each Flush
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes []string
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushes = append(f.flushes, f.Body.String())
+	f.ResponseRecorder.Flush()
+}
+
+type failer struct{}
+
+func (failer) Fail() (string, error) {
+	return "", errors.New("Stock Error")
+}
+
+func TestActStream(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.html": {Data: []byte(`{{define "base"}}<html><head>{{if .Early}}{{.Early.Fail}}{{end}}<title>{{.Title}}</title></head><body>{{range .Rows}}<p>{{.}}</p>{{end}}{{flush}}{{if .Fail}}{{.Fail.Fail}}{{end}}</body></html>{{end}}`)},
+	}
+	l, err := NewFS(fsys, nil, "base", "base.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := make([]string, 1000)
+	for i := range rows {
+		rows[i] = fmt.Sprint("row ", i)
+	}
+	// fail is "", "Early", or "Fail" (late)
+	action := func(fail string) Action {
+		return func(r *http.Request) (map[string]interface{}, error) {
+			data := map[string]interface{}{"Title": "Stream", "Rows": rows}
+			if len(fail) > 0 {
+				data[fail] = failer{}
+			}
+			return data, nil
+		}
+	}
+
+	// whole page streamed, flushed after </head> and at {{flush}}
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	l.ActWith(Options{Stream: true}, action(""), DefaultError(t), NoVolatility).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.HasSuffix(w.Body.String(), "<p>row 999</p></body></html>") {
+		t.Error("expected:\tcomplete page\tactual:\t", w.Body.String())
+	}
+	if len(w.flushes) < 2 || !strings.HasSuffix(w.flushes[0], "</head><body>") {
+		t.Error("expected:\tflush after </head>\tactual:\t", len(w.flushes), "flushes")
+	}
+	if tag := w.Header().Get("ETag"); len(tag) > 0 {
+		t.Error("expected:\tno ETag\tactual:\tETag:", tag)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Error("expected:\tContent-Type: text/html; charset=utf-8\tactual:\tContent-Type:", ct)
+	}
+
+	// failure after the page was partly sent ends it with the marker
+	w = &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	l.ActWith(Options{Stream: true}, action("Fail"), DefaultError(t), ExtremeVolatility).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 || !strings.HasSuffix(w.Body.String(), streamErrorMarker) || !strings.Contains(w.Body.String(), "row 999") {
+		t.Error("expected:\tstatus 200 page ending with marker\tactual:\tstatus ", w.Code, w.Body.String())
+	}
+
+	// failure before anything was sent still goes to the ErrorHandler
+	w = &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	l.ActWith(Options{Stream: true}, action("Early"), DefaultError(t), ExtremeVolatility).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := strings.TrimSpace(w.Body.String()); w.Code != 500 || body != "1" {
+		t.Error("expected:\tstatus 500 1\tactual:\tstatus ", w.Code, body)
+	}
+}
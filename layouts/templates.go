@@ -0,0 +1,87 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"context"
+	"html/template"
+	"sync"
+	"time"
+)
+
+// templateStore keeps the parsed templates for a handler created by Act, so that
+// requests clone them instead of loading every time.
+type templateStore struct {
+	layout   *Layout
+	patterns []string         // handler specific patterns, parsed after the Layout's patterns
+	funcs    template.FuncMap // handler specific functions
+	base     string           // the template executed by the handler
+	ttl      time.Duration    // stored templates are dropped after ttl; < 0 keeps them; 0 never stores them
+
+	lock   sync.Mutex
+	stored *template.Template
+}
+
+// Create a templateStore for a handler's templates and register it with the Layout.
+func (l *Layout) store(ttl time.Duration, opts Options, templates []string) *templateStore {
+	s := &templateStore{
+		layout:   l,
+		patterns: opts.patterns(templates),
+		funcs:    opts.Funcs,
+		base:     opts.base(l),
+		ttl:      ttl,
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.stores = append(l.stores, s)
+	return s
+}
+
+// Returns a clone of the stored templates, loading them when needed for the request with ctx.
+func (s *templateStore) get(ctx context.Context) (*template.Template, error) {
+	if s.ttl == 0 {
+		return s.load(ctx)
+	}
+	// lock to ensure we don't have multiple requests attempting to reload the
+	// templates at the same time
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stored == nil {
+		t, err := s.load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.stored = t
+		if s.ttl > 0 {
+			time.AfterFunc(s.ttl, s.invalidate)
+		}
+	}
+	return s.stored.Clone()
+}
+
+// Drop the stored templates so they are loaded again by the next request.
+func (s *templateStore) invalidate() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stored = nil
+}
+
+// Load the templates again, keeping the stored templates if they fail to parse.
+func (s *templateStore) reload() error {
+	if s.ttl == 0 {
+		return nil // loaded by every request anyway
+	}
+	t, err := s.load(context.Background())
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stored = t
+	return nil
+}
+
+func (s *templateStore) load(ctx context.Context) (*template.Template, error) {
+	return s.layout.load(ctx, s.funcs, s.patterns...)
+}
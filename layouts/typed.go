@@ -0,0 +1,62 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// A TypedAction is an Action whose data is a T, typically a struct, rather than a map,
+// so that templates reaching for a field that does not exist are caught by ActTyped
+// before serving traffic instead of at render time.
+type TypedAction[T any] func(*http.Request) (T, error)
+
+// Returns a TypedAction that must complete within d, like Action.Timeout.
+func (a TypedAction[T]) Timeout(d time.Duration) TypedAction[T] {
+	return timeout(a, d)
+}
+
+// ActTyped creates an http.Handler like Act that executes the Layout's base template
+// with the T returned by respond.
+// The templates are executed with a zero T (or a pointer to one) when the handler is
+// created (unless the Layout is LazyLoad), panicking if they refer to fields or methods
+// that T does not have.
+// Data from a TypedAction may implement LastModified() time.Time to set the Last-Modified header.
+func ActTyped[T any](l *Layout, respond TypedAction[T], eh ErrorHandler, volatility Volatility, templates ...string) http.Handler {
+	return ActTypedWith(l, Options{}, respond, eh, volatility, templates...)
+}
+
+// ActTypedWith creates an http.Handler like ActTyped, adjusted by the Options.
+func ActTypedWith[T any](l *Layout, opts Options, respond TypedAction[T], eh ErrorHandler, volatility Volatility, templates ...string) http.Handler {
+	if !l.LazyLoad {
+		if err := checkTyped[T](l, opts, templates); err != nil {
+			panic(err)
+		}
+	}
+	return act(l, opts, respond, eh, volatility, templates)
+}
+
+// checkTyped executes the templates with a zero T, returning any error caused by
+// a field or method missing from T. Other errors are expected from zero values
+// (e.g. nil pointers) and ignored.
+func checkTyped[T any](l *Layout, opts Options, templates []string) error {
+	t, err := l.load(context.Background(), opts.Funcs, opts.patterns(templates)...)
+	if err != nil {
+		return err
+	}
+	var data interface{} = *new(T)
+	if rt := reflect.TypeOf((*T)(nil)).Elem(); rt.Kind() == reflect.Ptr {
+		data = reflect.New(rt.Elem()).Interface()
+	}
+	if err := t.ExecuteTemplate(io.Discard, opts.base(l), data); err != nil && strings.Contains(err.Error(), "can't evaluate field") {
+		return fmt.Errorf("layouts: templates do not fit %T: %v", data, err)
+	}
+	return nil
+}
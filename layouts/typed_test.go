@@ -0,0 +1,69 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countPage struct {
+	Count    int
+	Modified time.Time
+}
+
+func (p countPage) LastModified() time.Time {
+	return p.Modified
+}
+
+type titlePage struct {
+	Title string
+}
+
+func TestActTyped(t *testing.T) {
+	l, err := New(nil, "base", ".test/base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2016, time.March, 31, 12, 0, 0, 0, time.UTC)
+
+	w := httptest.NewRecorder()
+	ActTyped(l, func(r *http.Request) (countPage, error) {
+		return countPage{Count: 1, Modified: modified}, nil
+	}, DefaultError(t), NoVolatility).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := strings.TrimSpace(w.Body.String()); w.Code != 200 || body != "1" {
+		t.Error("expected:\tstatus 200 1\tactual:\tstatus ", w.Code, body)
+	}
+	if lm := w.Header().Get("Last-Modified"); lm != modified.Format(http.TimeFormat) {
+		t.Error("expected:\tLast-Modified:", modified.Format(http.TimeFormat), "\tactual:\tLast-Modified:", lm)
+	}
+
+	w = httptest.NewRecorder()
+	ActTyped(l, func(r *http.Request) (*countPage, error) {
+		return &countPage{Count: 2}, nil
+	}, DefaultError(t), ExtremeVolatility).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := strings.TrimSpace(w.Body.String()); w.Code != 200 || body != "2" {
+		t.Error("expected:\tstatus 200 2\tactual:\tstatus ", w.Code, body)
+	}
+}
+
+func TestActTypedMissingField(t *testing.T) {
+	l, err := New(nil, "base", ".test/base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected:\tpanic for missing field Count\tactual:\tno panic")
+		} else if !strings.Contains(r.(error).Error(), "Count") {
+			t.Error("expected:\tpanic for missing field Count\tactual:\t", r)
+		}
+	}()
+	ActTyped(l, func(r *http.Request) (titlePage, error) {
+		return titlePage{}, nil
+	}, nil, NoVolatility)
+}
@@ -0,0 +1,141 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"path"
+	"strings"
+	"text/template/parse"
+)
+
+// ValidationErrors lists every problem found by Validate.
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Validate loads the templates of every handler created from the Layout, checking
+// that each pattern matches files, each file parses, the base template exists, and
+// every {{template "name"}} refers to a template that is defined. All problems are
+// returned together as ValidationErrors, with their file and line where known.
+func (l *Layout) Validate() error {
+	l.lock.Lock()
+	stores := append([]*templateStore(nil), l.stores...)
+	l.lock.Unlock()
+
+	var errs ValidationErrors
+	reported := make(map[string]bool) // handlers share the Layout's patterns, so only report once
+	report := func(err error) {
+		if !reported[err.Error()] {
+			reported[err.Error()] = true
+			errs = append(errs, err)
+		}
+	}
+	if len(stores) == 0 {
+		// still worth checking the Layout's own patterns
+		stores = append(stores, &templateStore{layout: l, base: l.baseTemplate})
+	}
+	for _, s := range stores {
+		for _, err := range s.validate() {
+			report(err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validate checks the templates for one handler.
+func (s *templateStore) validate() []error {
+	l := s.layout
+	var errs []error
+	all := append(append([]string(nil), l.patterns...), s.patterns...)
+
+	// parse each file on its own so that every syntax error is found
+	parsed := true
+	for _, p := range all {
+		matches, err := l.glob(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", p, err))
+			parsed = false
+			continue
+		}
+		if len(matches) == 0 {
+			errs = append(errs, fmt.Errorf("%s: pattern matches no files", p))
+			parsed = false
+		}
+		for _, m := range matches {
+			b, err := l.readFile(m)
+			if err == nil {
+				_, err = template.New(path.Base(m)).Funcs(l.funcs(s.funcs)).Parse(string(b))
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", m, err))
+				parsed = false
+			}
+		}
+	}
+	if !parsed {
+		return errs
+	}
+
+	t, err := s.load(context.Background())
+	if err != nil {
+		return append(errs, err)
+	}
+	if !defined(t, s.base) {
+		errs = append(errs, fmt.Errorf("%v: base template %q is not defined", all, s.base))
+	}
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+			continue
+		}
+		walk(tmpl.Tree.Root, func(n *parse.TemplateNode) {
+			if !defined(t, n.Name) {
+				location, _ := tmpl.Tree.ErrorContext(n)
+				errs = append(errs, fmt.Errorf("%s: template %q is not defined", location, n.Name))
+			}
+		})
+	}
+	return errs
+}
+
+// defined reports whether the set has a template with the name and a body.
+func defined(t *template.Template, name string) bool {
+	tmpl := t.Lookup(name)
+	return tmpl != nil && tmpl.Tree != nil
+}
+
+// walk calls fn for every {{template}} node under n.
+func walk(n parse.Node, fn func(*parse.TemplateNode)) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			walk(c, fn)
+		}
+	case *parse.IfNode:
+		walk(n.List, fn)
+		walk(n.ElseList, fn)
+	case *parse.RangeNode:
+		walk(n.List, fn)
+		walk(n.ElseList, fn)
+	case *parse.WithNode:
+		walk(n.List, fn)
+		walk(n.ElseList, fn)
+	case *parse.TemplateNode:
+		fn(n)
+	}
+}
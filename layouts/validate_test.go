@@ -0,0 +1,77 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestValidate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html":  {Data: []byte(`{{define "base"}}{{template "nav" .}}{{template "page" .}}{{end}}`)},
+		"helpers/nav.html":   {Data: []byte(`{{define "nav"}}nav{{end}}`)},
+		"good/page.html":     {Data: []byte(`{{define "page"}}good{{end}}`)},
+		"missing/page.html":  {Data: []byte("{{define \"page\"}}\n{{if .}}{{template \"footer\" .}}{{end}}{{end}}")},
+		"broken/page.html":   {Data: []byte("{{define \"page\"}}\n{{.Broken}{{end}}")},
+		"broken/other.html":  {Data: []byte("{{define \"other\"}}\n\n{{undefinedFunc}}{{end}}")},
+		"nobase/layout.html": {Data: []byte(`{{define "other"}}{{end}}`)},
+	}
+
+	// Handler templates        | Problems
+	// -------------------------|--------------------------------------
+	// good/*.html              | none
+	// missing/*.html           | footer undefined at missing/page.html:2
+	// broken/*.html            | syntax errors in both files
+	// empty/*.html             | no files
+	testCases := []struct {
+		Templates []string
+		Problems  []string
+	}{
+		{[]string{"good/*.html"}, nil},
+		{[]string{"missing/*.html"}, []string{`page.html:2:`, `template "footer" is not defined`}},
+		{[]string{"broken/*.html"}, []string{"broken/page.html", "page.html:2:", "broken/other.html", "other.html:3:"}},
+		{[]string{"empty/*.html"}, []string{"empty/*.html: pattern matches no files"}},
+	}
+	for idx, tc := range testCases {
+		l, err := NewFS(fsys, nil, "base", "layouts/*.html", "helpers/*.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.LazyLoad = true
+		l.Act(NilNilAction(), nil, NoVolatility, tc.Templates...)
+		err = l.Validate()
+		if len(tc.Problems) == 0 {
+			if err != nil {
+				t.Error("test\t", idx, "\texpected:\tnil\tactual:\t", err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Error("test\t", idx, "\texpected:\t", tc.Problems, "\tactual:\tnil")
+			continue
+		}
+		for _, p := range tc.Problems {
+			if !strings.Contains(err.Error(), p) {
+				t.Error("test\t", idx, "\texpected:\t", p, "\tactual:\t", err)
+			}
+		}
+	}
+
+	// the base template must exist, and problems across handlers are all reported
+	l, err := NewFS(fsys, nil, "base", "nobase/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.LazyLoad = true
+	l.Act(NilNilAction(), nil, NoVolatility, "good/*.html")
+	l.Act(NilNilAction(), nil, ExtremeVolatility, "empty/*.html")
+	err = l.Validate()
+	if errs, ok := err.(ValidationErrors); !ok || len(errs) != 2 {
+		t.Error("expected:\t2 ValidationErrors\tactual:\t", err)
+	} else if !strings.Contains(errs[0].Error(), `base template "base" is not defined`) {
+		t.Error("expected:\tbase template \"base\" is not defined\tactual:\t", errs[0])
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Watch polls the files matched by the Layout's patterns and each handler's templates
+// every interval, reloading the stored templates of only those handlers whose files
+// have changed. A change must be stable for one interval before reloading, so that
+// files are not read halfway through being written. When the changed templates fail
+// to parse, the error is logged and the handler keeps serving its previous templates.
+// Watch is meant for development; call the returned function to stop watching.
+func (l *Layout) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	w := &watcher{
+		layout: l,
+		seen:   make(map[*templateStore]string),
+		loaded: make(map[*templateStore]string),
+	}
+	w.poll()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.poll()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+type watcher struct {
+	layout *Layout
+	seen   map[*templateStore]string // signature at the last poll
+	loaded map[*templateStore]string // signature at the last load
+}
+
+// poll reloads stores whose signature has changed since they were loaded and
+// has not changed since the last poll. Stores seen for the first time are only recorded.
+func (w *watcher) poll() {
+	l := w.layout
+	l.lock.Lock()
+	stores := append([]*templateStore(nil), l.stores...)
+	l.lock.Unlock()
+	for _, s := range stores {
+		patterns := append(append([]string(nil), l.patterns...), s.patterns...)
+		sig := l.signature(patterns)
+		last, ok := w.seen[s]
+		w.seen[s] = sig
+		if !ok {
+			w.loaded[s] = sig
+			continue
+		}
+		if sig != last || sig == w.loaded[s] {
+			continue
+		}
+		w.loaded[s] = sig
+		if err := s.reload(); err != nil {
+			log.Printf("\x1b[1;31mTemplates:\x1b[0m \x1b[33m%v\x1b[0m %v", patterns, err)
+		}
+	}
+}
+
+// signature describes the files matched by the patterns, changing whenever a
+// file is added, removed, or modified.
+func (l *Layout) signature(patterns []string) string {
+	var sig []string
+	for _, p := range patterns {
+		matches, err := l.glob(p)
+		if err != nil {
+			sig = append(sig, p+": "+err.Error())
+			continue
+		}
+		for _, m := range matches {
+			if fi, err := l.stat(m); err != nil {
+				sig = append(sig, m+": "+err.Error())
+			} else {
+				sig = append(sig, fmt.Sprintf("%s %d %d", m, fi.Size(), fi.ModTime().UnixNano()))
+			}
+		}
+	}
+	return strings.Join(sig, "\n")
+}
@@ -0,0 +1,82 @@
+// Copyright 2013-2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package layouts
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layouts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string, mod time.Time) {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	body := func(h http.Handler) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return strings.TrimSpace(w.Body.String())
+	}
+	start := time.Now().Add(-time.Hour)
+	write("base", `{{define "base"}}{{template "page" .}}{{end}}`, start)
+	write("one", `{{define "page"}}one{{end}}`, start)
+	write("two", `{{define "page"}}two{{end}}`, start)
+
+	l, err := New(nil, "base", filepath.Join(dir, "base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := l.Act(NilNilAction(), nil, NoVolatility, filepath.Join(dir, "one"))
+	two := l.Act(NilNilAction(), nil, NoVolatility, filepath.Join(dir, "two"))
+	stop := l.Watch(10 * time.Millisecond)
+	defer stop()
+
+	// Change                | one        | two
+	// ----------------------|------------|-----
+	// none                  | one        | two
+	// one edited            | one v2     | two
+	// one fails to parse    | one v2     | two
+	// base edited           | one v2     | [two] (one still fails to parse)
+	// one fixed             | [one v3]   | [two]
+	testCases := []struct {
+		File    string
+		Content string
+		One     string
+		Two     string
+	}{
+		{"", "", "one", "two"},
+		{"one", `{{define "page"}}one v2{{end}}`, "one v2", "two"},
+		{"one", `{{define "page"}}{{.Broken}`, "one v2", "two"},
+		{"base", `{{define "base"}}[{{template "page" .}}]{{end}}`, "one v2", "[two]"},
+		{"one", `{{define "page"}}one v3{{end}}`, "[one v3]", "[two]"},
+	}
+	for idx, tc := range testCases {
+		if len(tc.File) > 0 {
+			write(tc.File, tc.Content, start.Add(time.Duration(idx)*time.Minute))
+			<-time.After(50 * time.Millisecond)
+		}
+		if actual := body(one); actual != tc.One {
+			t.Error("test\t", idx, "\tone:\texpected:\t", tc.One, "\tactual:\t", actual)
+		}
+		if actual := body(two); actual != tc.Two {
+			t.Error("test\t", idx, "\ttwo:\texpected:\t", tc.Two, "\tactual:\t", actual)
+		}
+	}
+}
@@ -4,16 +4,26 @@
 package main
 
 import (
+	"crypto/rand"
+	"embed"
 	"flag"
+	"html/template"
+	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/lazyengineering/gobase/assets"
 	"github.com/lazyengineering/gobase/envflag"
 	"github.com/lazyengineering/gobase/layouts"
 	"github.com/lazyengineering/gobase/layouts/filters"
 	"github.com/lazyengineering/gobase/middleware"
+	"github.com/lazyengineering/gobase/sessions"
 )
 
 // Important metadata
@@ -24,7 +34,42 @@ var (
 
 var Layout *layouts.Layout
 
-func init() {
+// Static assets that are copies of files on a CDN, and the CDN's URLs for them.
+// Templates link to the CDN, checked against a hash of the copy, unless -vendor-locally is set,
+// so each URL must serve exactly the bytes of the copy in the static folder.
+var Vendored = map[string]string{
+	"js/vendor/jquery-1.10.1.min.js": "//code.jquery.com/jquery-1.10.1.min.js",
+}
+
+// Logs a record of each request served
+var AccessLogger *slog.Logger
+
+// The security headers for every response
+var SecurityPolicy middleware.SecurityPolicy
+
+// Signs the cookies for CSRF protection
+var CSRFKey []byte
+
+// Keeps each visitor's session in a signed cookie, encrypted when there are encryption keys
+var Sessions *sessions.Manager
+
+// How often expired sessions are swept from the session store
+const sessionSweep = 10 * time.Minute
+
+// Duration over which a request is slow, unless a route sets its own with middleware.Slow
+var SlowRequest = flag.Duration("slow-request", middleware.DefaultSlow, "Duration over which a request is considered slow")
+
+// The most recent slow requests, reported at /debug/slow when enabled
+var SlowLog *middleware.SlowLog
+
+// The static assets and templates, embedded so the binary can run on its own
+//
+//go:embed static
+var staticFiles embed.FS
+
+// setup parses the flags and registers the handlers; it is called by main rather than run as
+// init, so that the package can be tested
+func setup() {
 	t := time.Now() // measure bootstrap time
 	defer func() {
 		log.Printf("\x1b[1;32mBootstrapped:\x1b[0m \x1b[34m%8d\x1b[0mµs", time.Since(t).Nanoseconds()/1000)
@@ -33,9 +78,22 @@ func init() {
 	// Flags only useful in init
 	var (
 		NoTimestamp        = flag.Bool("no-timestamp", false, "When set to true, removes timestamp from log statements")
+		LogFormat          = flag.String("log-format", "console", "Format of the access log: console, text, json, or combined (Apache)")
+		VendorLocally      = flag.Bool("vendor-locally", false, "When set to true, serves vendored copies of CDN assets (e.g. jQuery) from the static folder instead of the CDN")
+		ContentSecurity    = flag.String("content-security-policy", contentSecurityPolicy, "Content-Security-Policy header, where "+middleware.NoncePlaceholder+" is replaced by a nonce for each request")
+		CSRFSecret         = flag.String("csrf-key", "", "Key for signing CSRF cookies; when not set, a random key is used, so tokens don't survive a restart")
+		SessionKeys        = flag.String("session-keys", "", "Comma separated keys for signing session cookies, newest first so old keys can be rotated out; when not set, a random key is used, so sessions don't survive a restart")
+		SessionCryptKeys   = flag.String("session-encryption-keys", "", "Comma separated 16, 24, or 32 byte keys for encrypting session cookies with AES-GCM, newest first; when not set, cookies are signed but readable")
+		SessionMaxAge      = flag.Duration("session-max-age", 0, "How long a session lasts; when not set, it lasts until the browser is closed")
+		SessionStore       = flag.String("session-store", "cookie", "Where sessions are kept: cookie, memory, or file (in -session-dir)")
+		SessionDir         = flag.String("session-dir", sessionDir(), "Private folder for sessions when -session-store is file")
+		SlowLogSize        = flag.Int("slow-log", 0, "When set, keeps this many of the most recent slow requests and reports them at /debug/slow")
 		StaticDir          = flag.String("static-dir", "static", "Static Assets folder")
+		Embedded           = flag.Bool("embedded", false, "When set to true, serves static assets and templates embedded in the binary instead of from the filesystem")
 		LayoutTemplateGlob = flag.String("layouts", "static/templates/layouts/*.html", "Pattern for layout templates")
 		HelperTemplateGlob = flag.String("helpers", "static/templates/helpers/*.html", "Pattern for helper templates")
+		ErrorTemplateDir   = flag.String("error-templates", "static/templates/errors", "Folder of error page templates, named by status code (e.g. 404.html, 4xx.html, error.html)")
+		WatchTemplates     = flag.Duration("watch-templates", 0, "When set, poll templates for changes at this interval and reload them (for development)")
 	)
 
 	// To Parse flags, looking for command-line, then ENV, then defaults
@@ -49,45 +107,173 @@ func init() {
 	if *NoTimestamp {
 		log.SetFlags(0)
 	}
+	AccessLogger = slog.New(accessLogHandler(*LogFormat, *NoTimestamp))
+
+	// Security headers, with a nonce for inline scripts in templates
+	SecurityPolicy = middleware.DefaultSecurityPolicy
+	SecurityPolicy.ContentSecurityPolicy = *ContentSecurity
+
+	// CSRF protection for forms
+	CSRFKey = []byte(*CSRFSecret)
+	if len(CSRFKey) == 0 {
+		CSRFKey = make([]byte, 32)
+		rand.Read(CSRFKey)
+	}
+
+	// Sessions, for Actions and templates (e.g. flashes) to remember a visitor
+	sessionKeys := splitKeys(*SessionKeys)
+	if len(sessionKeys) == 0 {
+		key := make([]byte, 32)
+		rand.Read(key)
+		sessionKeys = append(sessionKeys, key)
+	}
+	var err error
+	Sessions, err = sessions.New(sessionKeys, splitKeys(*SessionCryptKeys))
+	if err != nil {
+		// this is a fatal condition
+		panic(err)
+	}
+	Sessions.MaxAge = *SessionMaxAge
+	switch *SessionStore {
+	case "memory":
+		Sessions.Store = sessions.NewMemoryStore(sessionSweep)
+	case "file":
+		if len(*SessionDir) == 0 {
+			// this is a fatal condition
+			panic("no folder for sessions; set -session-dir")
+		}
+		Sessions.Store, err = sessions.NewFileStore(*SessionDir, sessionSweep)
+		if err != nil {
+			// this is a fatal condition
+			panic(err)
+		}
+	case "cookie":
+	default:
+		log.Printf("\x1b[1;31mUnknown session store:\x1b[0m %q, using cookie", *SessionStore)
+	}
+
+	if *SlowLogSize > 0 {
+		SlowLog = middleware.NewSlowLog(*SlowLogSize)
+		Handle("/debug/slow", SlowLog)
+	}
+	checkTemplates := flag.Arg(0) == "check-templates"
 
 	// Static Asset Serving
-	staticServer := NoIndex(middleware.Cache(24*time.Hour, http.FileServer(http.Dir(*StaticDir))))
-	Handle("/js/", staticServer)
-	Handle("/css/", staticServer)
-	Handle("/fonts/", staticServer)
-	Handle("/img/", staticServer)
-	Handle("/favicon.ico", staticServer)
+	staticFS := os.DirFS(*StaticDir)
+	if *Embedded {
+		sub, err := fs.Sub(staticFiles, "static")
+		if err != nil {
+			// this is a fatal condition
+			panic(err)
+		}
+		staticFS = sub
+	}
+	// fingerprint assets, so that templates can link to paths that are cached forever
+	manifest, err := assets.NewManifest(staticFS)
+	if err != nil {
+		// this is a fatal condition
+		panic(err)
+	}
+	filters.AssetPath = manifest.Path
+	filters.AssetIntegrity = manifest.Integrity
+	filters.Vendored = Vendored
+	filters.VendorLocally = *VendorLocally
+	for _, name := range sortedKeys(Vendored) {
+		if len(manifest.Integrity(name)) == 0 {
+			log.Printf("\x1b[1;31mMissing vendored asset:\x1b[0m \x1b[33m%s\x1b[0m copy it from %s", name, Vendored[name])
+		}
+	}
+	staticServer := NoIndex(middleware.Cache(24*time.Hour, manifest.Handler(assets.FileServer(http.FS(staticFS)))))
+	HandleStatic("/js/", staticServer)
+	HandleStatic("/css/", staticServer)
+	HandleStatic("/fonts/", staticServer)
+	HandleStatic("/img/", staticServer)
+	HandleStatic("/favicon.ico", staticServer)
 
 	// Layouts
-	var err error
-	Layout, err = layouts.New(filters.All, "bootstrap.html", *LayoutTemplateGlob, *HelperTemplateGlob)
+	funcs := template.FuncMap{"nav": func() Nav { return Nav{} }} // bound to each request by requestFuncs
+	for name, f := range filters.All {
+		funcs[name] = f
+	}
+	if *Embedded {
+		Layout, err = layouts.NewFS(staticFiles, funcs, "bootstrap.html", *LayoutTemplateGlob, *HelperTemplateGlob)
+	} else {
+		Layout, err = layouts.New(funcs, "bootstrap.html", *LayoutTemplateGlob, *HelperTemplateGlob)
+	}
+	if err != nil {
+		// this is a fatal condition
+		panic(err)
+	}
+	// when checking templates, report every problem at once in main instead of panicking here
+	Layout.LazyLoad = checkTemplates
+	Layout.RequestFuncs = requestFuncs
+	ErrorPages, err = Layout.ErrorPages(*ErrorTemplateDir, site)
 	if err != nil {
 		// this is a fatal condition
 		panic(err)
 	}
+	if *WatchTemplates > 0 {
+		Layout.Watch(*WatchTemplates)
+	}
 
 	// Actual Web Application Handlers
-	HandleNoSubPaths("/", Layout.Act(hello, Error500, layouts.NoVolatility, "static/templates/hello/*.html"))
+	HandleNoSubPaths("/", Layout.ActNegotiated(hello, Error, layouts.NoVolatility, "static/templates/hello/*.html"))
 }
 
-// Log and Handle http requests
+// Log and Handle http requests with a request ID, security headers, CSRF protection, and
+// sessions, compressing responses and recovering from panics with the 500 page
 func Handle(path string, h http.Handler) {
+	handle(path, middleware.CSRF(CSRFKey, func(res http.ResponseWriter, req *http.Request, err error) {
+		Error(res, req, layouts.Forbidden(err))
+	}, Sessions.Handler(h)))
+}
+
+// HandleStatic is Handle for static assets, without CSRF protection or sessions: assets are
+// cached publicly, and a cache that kept a cookie set on one would give it to every client.
+func HandleStatic(path string, h http.Handler) {
+	handle(path, h)
+}
+
+// handle logs and handles http requests with a request ID and security headers, compressing
+// responses and recovering from panics with the 500 page
+func handle(path string, h http.Handler) {
 	if strings.HasSuffix(path, "/") { // redirect for directories
 		indexRedirect := http.RedirectHandler(path, http.StatusMovedPermanently)
-		Handle(path+"index.html", indexRedirect)
-		Handle(path+"index.htm", indexRedirect)
-		Handle(path+"index.php", indexRedirect) // not that anybody would think...
+		handle(path+"index.html", indexRedirect)
+		handle(path+"index.htm", indexRedirect)
+		handle(path+"index.php", indexRedirect) // not that anybody would think...
 	}
-	http.HandleFunc(path, func(r http.ResponseWriter, q *http.Request) {
-		t := time.Now()
-		h.ServeHTTP(r, q)
-		s := time.Since(t).Nanoseconds() / 1000 // time in µs
-		message := "\x1b[1;36mServed: \x1b[0m"
-		if s > 10000 { // > 10ms is a "long" request, mark in red with a *
-			message = "\x1b[1;31mServed*:\x1b[0m"
+	h = middleware.Recover(Error500, middleware.Compress(nil, h))
+	if SlowLog != nil {
+		h = SlowLog.Track(h)
+	}
+	h = middleware.SecureHeaders(SecurityPolicy, middleware.Slow(*SlowRequest, h))
+	http.Handle(path, middleware.RequestID(middleware.AccessLog(AccessLogger, h)))
+}
+
+// The slog.Handler for the access log in the given format, written to stderr like the rest of the log
+func accessLogHandler(format string, noTimestamp bool) slog.Handler {
+	opts := new(slog.HandlerOptions)
+	if noTimestamp {
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
 		}
-		log.Printf("%s \x1b[34m%8d\x1b[0mµs \x1b[33m%s\x1b[0m", message, s, q.URL.String())
-	})
+	}
+	switch format {
+	case "text":
+		return slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		return slog.NewJSONHandler(os.Stderr, opts)
+	case "combined":
+		return middleware.NewCombinedHandler(os.Stderr, opts)
+	case "console":
+	default:
+		log.Printf("\x1b[1;31mUnknown log format:\x1b[0m %q, using console", format)
+	}
+	return middleware.NewConsoleHandler(os.Stderr, &middleware.ConsoleOptions{NoTimestamp: noTimestamp})
 }
 
 func HandleFunc(path string, h http.HandlerFunc) {
@@ -119,23 +305,110 @@ func NoSubPaths(path string, h http.Handler) http.Handler {
 }
 
 func main() {
+	setup()
+	if flag.Arg(0) == "check-templates" {
+		if err := Layout.Validate(); err != nil {
+			log.Fatalln("\x1b[1;31mTemplate Errors:\x1b[0m\n" + err.Error())
+		}
+		log.Println("\x1b[32mtemplates ok\x1b[0m")
+		return
+	}
 	log.Println("\x1b[32mlistening at \x1b[1;32m" + *ServerAddr + "\x1b[32m...\x1b[0m")
 	log.Fatalln("Fatal Error:", http.ListenAndServe(*ServerAddr, nil))
 }
 
+// Nav is the navbar's view of the request, as {{nav}} in templates. It comes from a template
+// function rather than an Action's data, since Actions may be cached across requests and users.
 type Nav struct {
 	*http.Request
 }
 
 func (n Nav) IsCurrent(p string) bool {
-	return p == n.Request.URL.Path
+	return n.Request != nil && p == n.Request.URL.Path
 }
 
-func hello(req *http.Request) (map[string]interface{}, error) {
-	return map[string]interface{}{
-		"Title":        "Hello World",
-		"BodyClass":    "hello",
-		"Nav":          Nav{req},
+// Session returns the visitor's session, which is nil outside of a request. A page using it
+// is kept out of caches, since it may show anything in the session.
+func (n Nav) Session() *sessions.Session {
+	if n.Request == nil {
+		return nil
+	}
+	layouts.Unique(n.Request)
+	return sessions.From(n.Request.Context())
+}
+
+// User returns the name of the signed in visitor, or "" when nobody is signed in. Only a page
+// showing a name is kept out of caches.
+func (n Nav) User() string {
+	if n.Request == nil {
+		return ""
+	}
+	user := sessions.From(n.Request.Context()).Get("user")
+	if len(user) > 0 {
+		layouts.Unique(n.Request)
+	}
+	return user
+}
+
+// The template functions bound to each request: filters.Request, and nav
+func requestFuncs(req *http.Request) template.FuncMap {
+	funcs := filters.Request(req)
+	funcs["nav"] = func() Nav { return Nav{req} }
+	return funcs
+}
+
+// Data needed by every page on the site
+func site(req *http.Request) (map[string]interface{}, error) {
+	data := map[string]interface{}{
 		"GATrackingID": *GATrackingID,
-	}, nil
+	}
+	layouts.MarkPrivate(data, "GATrackingID")
+	return data, nil
+}
+
+func hello(req *http.Request) (map[string]interface{}, error) {
+	return layouts.MergeActions(site, func(req *http.Request) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"Title":     "Hello World",
+			"BodyClass": "hello",
+		}, nil
+	})(req)
+}
+
+// Allows the CDNs for Vendored assets and Bootstrap, Google Analytics, and inline scripts with the request's nonce
+const contentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'nonce-" + middleware.NoncePlaceholder + "' code.jquery.com netdna.bootstrapcdn.com ssl.google-analytics.com www.google-analytics.com; " +
+	"style-src 'self' netdna.bootstrapcdn.com; font-src 'self' netdna.bootstrapcdn.com; " +
+	"img-src 'self' data: ssl.google-analytics.com www.google-analytics.com; " +
+	"object-src 'none'; base-uri 'self'; frame-ancestors 'none'"
+
+// sessionDir returns the default folder for sessions, in the user's cache folder so that
+// other users can't read them, or "" when there is no such folder and -session-dir must be set
+func sessionDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gobase", "sessions")
+}
+
+// splitKeys returns the keys in a comma separated flag, skipping empty ones
+func splitKeys(s string) [][]byte {
+	var keys [][]byte
+	for _, k := range strings.Split(s, ",") {
+		if len(k) > 0 {
+			keys = append(keys, []byte(k))
+		}
+	}
+	return keys
+}
+
+// sortedKeys returns the keys of m in order, for logging
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,23 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package main
+
+import (
+	"io/fs"
+	"testing"
+)
+
+// Every vendored asset should have a copy in the static folder, for its integrity hash and
+// for -vendor-locally
+func TestVendoredAssets(t *testing.T) {
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range sortedKeys(Vendored) {
+		if _, err := fs.Stat(static, name); err != nil {
+			t.Error("expected:\t", name, "\tactual:\t", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Keys of the attributes AccessLog records for each request
+const (
+	MethodKey    = "method"
+	URLKey       = "url"
+	ProtoKey     = "proto"
+	StatusKey    = "status"
+	BytesKey     = "bytes"
+	DurationKey  = "duration"
+	RemoteKey    = "remote"
+	UserAgentKey = "user_agent"
+	RefererKey   = "referer"
+	SlowKey      = "slow"
+	PhasesKey    = "phases"
+	RequestIDKey = "request_id"
+)
+
+// AccessLog logs a record of each request served by h to logger, at Info level with the
+// message "Served", the time the request began, and attributes for the method, URL,
+// protocol, status, bytes written, duration, remote address, user agent, and referer, whether
+// the request was slow (see Slow), a group of any phases recorded with RecordPhase, and the
+// request ID when AccessLog is wrapped by RequestID.
+// A nil logger uses slog.Default().
+func AccessLog(logger *slog.Logger, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(r http.ResponseWriter, q *http.Request) {
+		start := time.Now()
+		t, q := withTiming(q)
+		w := wrap(r)
+		h.ServeHTTP(w, q)
+		d := time.Since(start)
+		threshold, phases := t.report()
+
+		l := logger
+		if l == nil {
+			l = slog.Default()
+		}
+		ctx := q.Context()
+		if !l.Enabled(ctx, slog.LevelInfo) {
+			return
+		}
+		status := w.Status()
+		if status == 0 {
+			status = http.StatusOK // nothing written, which the server sends as 200
+		}
+		record := slog.NewRecord(start, slog.LevelInfo, "Served", 0)
+		record.AddAttrs(
+			slog.String(MethodKey, q.Method),
+			slog.String(URLKey, q.URL.String()),
+			slog.String(ProtoKey, q.Proto),
+			slog.Int(StatusKey, status),
+			slog.Int64(BytesKey, w.size),
+			slog.Duration(DurationKey, d),
+			slog.String(RemoteKey, q.RemoteAddr),
+			slog.String(UserAgentKey, q.UserAgent()),
+			slog.String(RefererKey, q.Referer()),
+			slog.Bool(SlowKey, d > threshold),
+		)
+		if id := RequestIDFrom(ctx); len(id) > 0 {
+			record.AddAttrs(slog.String(RequestIDKey, id))
+		}
+		if len(phases) > 0 {
+			p := make([]any, len(phases))
+			for i, phase := range phases {
+				p[i] = slog.Duration(phase.Name, phase.Duration)
+			}
+			record.AddAttrs(slog.Group(PhasesKey, p...))
+		}
+		l.Handler().Handle(ctx, record)
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// AccessLog should record the status and size of what h wrote, along with the request
+func TestAccessLog(t *testing.T) {
+	type testCase struct {
+		H      http.HandlerFunc
+		Status float64
+		Bytes  float64
+	}
+
+	// h              | STATUS BYTES
+	// writes nothing | 200    0
+	// writes body    | 200    5
+	// not found      | 404    19
+	testCases := []testCase{
+		{func(w http.ResponseWriter, q *http.Request) {}, 200, 0},
+		{func(w http.ResponseWriter, q *http.Request) { io.WriteString(w, "hello") }, 200, 5},
+		{http.NotFound, 404, 19},
+	}
+	for idx, tc := range testCases {
+		b := new(bytes.Buffer)
+		req := httptest.NewRequest("GET", "/path?q=1", nil)
+		req.Header.Set("User-Agent", "tester")
+		AccessLog(slog.New(slog.NewJSONHandler(b, nil)), tc.H).ServeHTTP(httptest.NewRecorder(), req)
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(b.Bytes(), &record); err != nil {
+			t.Error("test\t", idx, "\t", err)
+			continue
+		}
+		expected := map[string]interface{}{
+			"msg":        "Served",
+			"method":     "GET",
+			"url":        "/path?q=1",
+			"status":     tc.Status,
+			"bytes":      tc.Bytes,
+			"user_agent": "tester",
+			"remote":     "192.0.2.1:1234",
+		}
+		for k, v := range expected {
+			if record[k] != v {
+				t.Error("test\t", idx, "\t", k, "\texpected:\t", v, "\tactual:\t", record[k])
+			}
+		}
+	}
+}
+
+// The console and combined handlers should format AccessLog records as single lines
+func TestAccessLogHandlers(t *testing.T) {
+	slow := func(w http.ResponseWriter, q *http.Request) {
+		time.Sleep(2 * time.Millisecond)
+		io.WriteString(w, "hello")
+	}
+	type testCase struct {
+		Handler func(io.Writer) slog.Handler
+		H       http.HandlerFunc
+		Line    *regexp.Regexp
+	}
+
+	// handler           | h    | LINE
+	// console           | fast | Served:  ...µs 200 GET /path
+	// console           | slow | Served*: ...µs 200 GET /path
+	// combined          | fast | 192.0.2.1 - - [...] "GET /path HTTP/1.1" 200 5 "-" "tester"
+	testCases := []testCase{
+		{
+			Handler: func(w io.Writer) slog.Handler {
+				return NewConsoleHandler(w, &ConsoleOptions{NoTimestamp: true})
+			},
+			H:    func(w http.ResponseWriter, q *http.Request) { io.WriteString(w, "hello") },
+			Line: regexp.MustCompile(`^Served:  +\d+µs 200 GET /path\n$`),
+		},
+		{
+			Handler: func(w io.Writer) slog.Handler {
+				return NewConsoleHandler(w, &ConsoleOptions{NoTimestamp: true})
+			},
+			H:    Slow(time.Millisecond, http.HandlerFunc(slow)).ServeHTTP,
+			Line: regexp.MustCompile(`^Served\*: +\d+µs 200 GET /path\n$`),
+		},
+		{
+			Handler: func(w io.Writer) slog.Handler { return NewCombinedHandler(w, nil) },
+			H:       func(w http.ResponseWriter, q *http.Request) { io.WriteString(w, "hello") },
+			Line:    regexp.MustCompile(`^192\.0\.2\.1 - - \[\d\d/\w+/\d{4}:\d\d:\d\d:\d\d [-+]\d{4}\] "GET /path HTTP/1\.1" 200 5 "-" "tester"\n$`),
+		},
+	}
+	for idx, tc := range testCases {
+		b := new(bytes.Buffer)
+		req := httptest.NewRequest("GET", "/path", nil)
+		req.Header.Set("User-Agent", "tester")
+		AccessLog(slog.New(tc.Handler(b)), tc.H).ServeHTTP(httptest.NewRecorder(), req)
+		if !tc.Line.Match(b.Bytes()) {
+			t.Error("test\t", idx, "\texpected:\t", tc.Line, "\tactual:\t", b.String())
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Encoding is a content-coding Compress can use for a response.
+type Encoding struct {
+	Name      string                         // as in Accept-Encoding and Content-Encoding, e.g. "gzip"
+	NewWriter func(io.Writer) io.WriteCloser // creates a writer that compresses to w; Flush is used when it has one
+}
+
+var (
+	Gzip = Encoding{"gzip", func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	}}
+	Deflate = Encoding{"deflate", func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression) // only errors for a bad level
+		return fw
+	}}
+
+	// The encodings used by Compress when none are given, in order of preference
+	DefaultEncodings = []Encoding{Gzip, Deflate}
+)
+
+// Bodies smaller than this are not worth compressing
+const minCompressSize = 1024
+
+// Compress compresses responses from h with the first of the encodings most preferred by the
+// request's Accept-Encoding header, or DefaultEncodings when encodings is nil.
+// Responses vary by Accept-Encoding, and so say so with a Vary header. Responses are left
+// alone when they are smaller than 1KB, already have a Content-Encoding, have a content
+// type that is already compressed (e.g. images), or answer a Range request.
+// A compressed response's ETag is made weak, as it is no longer byte-for-byte the
+// representation it names; conditional requests still match it with a weak comparison.
+func Compress(encodings []Encoding, h http.Handler) http.Handler {
+	if encodings == nil {
+		encodings = DefaultEncodings
+	}
+	return http.HandlerFunc(func(r http.ResponseWriter, q *http.Request) {
+		if len(q.Header.Get("Range")) > 0 {
+			h.ServeHTTP(r, q)
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter: r,
+			encoding:       negotiateEncoding(q.Header.Get("Accept-Encoding"), encodings),
+		}
+		h.ServeHTTP(cw, q)
+		cw.Close()
+	})
+}
+
+// NegotiateEncoding picks the content-coding named in names with the highest quality in accept,
+// an Accept-Encoding header, preferring earlier names when they are equal. It returns ""
+// when none are acceptable.
+func NegotiateEncoding(accept string, names ...string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) == 0 {
+			continue
+		}
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = f
+			}
+		}
+		qualities[name] = q
+	}
+	best, bestQ := "", 0.0
+	for _, name := range names {
+		q, ok := qualities[name]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// negotiateEncoding picks from encodings as NegotiateEncoding does, or nil when none are acceptable
+func negotiateEncoding(accept string, encodings []Encoding) *Encoding {
+	names := make([]string, len(encodings))
+	for i, e := range encodings {
+		names[i] = e.Name
+	}
+	name := NegotiateEncoding(accept, names...)
+	for i, e := range encodings {
+		if len(name) > 0 && e.Name == name {
+			return &encodings[i]
+		}
+	}
+	return nil
+}
+
+// compressWriter buffers the start of a response until it can decide whether to compress it
+type compressWriter struct {
+	http.ResponseWriter
+	encoding *Encoding // nil when the request accepts none
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	w       io.WriteCloser // the encoder, when compressing
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided {
+		cw.ResponseWriter.WriteHeader(status) // superfluous, which the server reports
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	if status < 200 {
+		cw.ResponseWriter.WriteHeader(status) // informational responses pass straight through
+		return
+	}
+	cw.status = status
+	if !bodyAllowed(status) {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.decided {
+		if cw.w != nil {
+			return cw.w.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	n, _ := cw.buf.Write(b)
+	if cw.buf.Len() >= minCompressSize {
+		if err := cw.decide(true); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Flush sends what has been written so far, compressing it if the response can be,
+// whatever its size so far, since a flushed response is expected to grow.
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if f, ok := cw.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close finishes the response once the handler is done
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.status == 0 && cw.buf.Len() == 0 {
+			return nil // nothing written: leave the response to the server
+		}
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		if err := cw.decide(cw.buf.Len() >= minCompressSize); err != nil {
+			return err
+		}
+	}
+	if cw.w != nil {
+		return cw.w.Close()
+	}
+	return nil
+}
+
+// decide writes the header, compressing the rest of the response if big enough and worth it,
+// then sends what was buffered.
+func (cw *compressWriter) decide(bigEnough bool) error {
+	cw.decided = true
+	header := cw.Header()
+	if bodyAllowed(cw.status) {
+		addVary(header, "Accept-Encoding")
+	}
+	if len(header.Get("Content-Type")) == 0 && cw.buf.Len() > 0 {
+		// sniff now, as the server would otherwise sniff the compressed bytes
+		header.Set("Content-Type", http.DetectContentType(cw.buf.Bytes()))
+	}
+	if bigEnough && cw.encoding != nil && bodyAllowed(cw.status) && cw.status != http.StatusPartialContent &&
+		len(header.Get("Content-Encoding")) == 0 && compressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", cw.encoding.Name)
+		header.Del("Content-Length")
+		if tag := header.Get("ETag"); len(tag) > 0 && !strings.HasPrefix(tag, "W/") {
+			header.Set("ETag", "W/"+tag)
+		}
+		cw.w = cw.encoding.NewWriter(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if cw.w != nil {
+		_, err = cw.w.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// bodyAllowed reports whether a response with status may have a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// addVary adds value to the Vary header, unless it is already there
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "*" || strings.EqualFold(f, value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+// compressible reports whether a body of the content type is worth compressing
+func compressible(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case t == "image/svg+xml":
+		return true
+	case strings.HasPrefix(t, "image/"), strings.HasPrefix(t, "video/"), strings.HasPrefix(t, "audio/"):
+		return false
+	}
+	switch t {
+	case "application/gzip", "application/x-gzip", "application/zip", "application/x-bzip2",
+		"application/x-7z-compressed", "application/x-rar-compressed", "application/x-xz",
+		"application/zstd", "application/pdf", "font/woff", "font/woff2", "application/font-woff":
+		return false
+	}
+	return true
+}
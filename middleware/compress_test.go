@@ -0,0 +1,135 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Compress should negotiate an encoding, and leave alone responses that aren't worth compressing
+func TestCompress(t *testing.T) {
+	big := strings.Repeat("hello, world. ", 200)
+	text := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, q *http.Request) {
+			w.Header().Set("ETag", `"abc"`)
+			io.WriteString(w, body)
+		}
+	}
+	png := func(w http.ResponseWriter, q *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, big)
+	}
+	encoded := func(w http.ResponseWriter, q *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		io.WriteString(w, big)
+	}
+	type testCase struct {
+		H        http.HandlerFunc
+		Accept   string
+		Range    string
+		Encoding string // expected Content-Encoding
+		Body     string
+	}
+
+	// h          | accept-encoding       | range   | ENCODING
+	// big text   | gzip                  |         | gzip
+	// big text   | deflate, gzip;q=0.5   |         | deflate
+	// big text   | gzip;q=0, *           |         | deflate
+	// big text   | br                    |         |
+	// big text   |                       |         |
+	// small text | gzip                  |         |
+	// png        | gzip                  |         |
+	// encoded    | gzip                  |         | br
+	// big text   | gzip                  | 0-10    |
+	testCases := []testCase{
+		{text(big), "gzip", "", "gzip", big},
+		{text(big), "deflate, gzip;q=0.5", "", "deflate", big},
+		{text(big), "gzip;q=0, *", "", "deflate", big},
+		{text(big), "br", "", "", big},
+		{text(big), "", "", "", big},
+		{text("small"), "gzip", "", "", "small"},
+		{png, "gzip", "", "", big},
+		{encoded, "gzip", "", "br", big},
+		{text(big), "gzip", "bytes=0-10", "", big},
+	}
+	for idx, tc := range testCases {
+		req := httptest.NewRequest("GET", "/", nil)
+		if len(tc.Accept) > 0 {
+			req.Header.Set("Accept-Encoding", tc.Accept)
+		}
+		if len(tc.Range) > 0 {
+			req.Header.Set("Range", tc.Range)
+		}
+		res := httptest.NewRecorder()
+		Compress(nil, tc.H).ServeHTTP(res, req)
+
+		if e := res.Header().Get("Content-Encoding"); e != tc.Encoding {
+			t.Error("test\t", idx, "\texpected:\t", tc.Encoding, "\tactual:\t", e)
+			continue
+		}
+		var body io.Reader = res.Body
+		switch tc.Encoding {
+		case "gzip":
+			gz, err := gzip.NewReader(res.Body)
+			if err != nil {
+				t.Error("test\t", idx, "\t", err)
+				continue
+			}
+			body = gz
+		case "deflate":
+			body = flate.NewReader(res.Body)
+		case "br":
+			continue
+		}
+		b, err := io.ReadAll(body)
+		if err != nil {
+			t.Error("test\t", idx, "\t", err)
+		} else if string(b) != tc.Body {
+			t.Error("test\t", idx, "\texpected:\t", len(tc.Body), "bytes\tactual:\t", len(b), "bytes")
+		}
+		if len(tc.Range) == 0 && res.Header().Get("Vary") != "Accept-Encoding" {
+			t.Error("test\t", idx, "\texpected:\t", "Vary: Accept-Encoding", "\tactual:\t", res.Header().Get("Vary"))
+		}
+		if tag := res.Header().Get("ETag"); tc.Encoding == "gzip" && tag != `W/"abc"` {
+			t.Error("test\t", idx, "\texpected:\t", `W/"abc"`, "\tactual:\t", tag)
+		}
+	}
+}
+
+// Compress should keep the Cache middleware's headers, and leave 304s without a body alone
+func TestCompressCache(t *testing.T) {
+	h := Cache(time.Hour, Compress(nil, http.HandlerFunc(func(w http.ResponseWriter, q *http.Request) {
+		if q.Header.Get("If-None-Match") == `W/"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		io.WriteString(w, strings.Repeat("a", 2*minCompressSize))
+	})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if cc := res.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+		t.Error("expected:\t", "public, max-age=3600", "\tactual:\t", cc)
+	}
+	if ct := res.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Error("expected:\t", "text/plain", "\tactual:\t", ct)
+	}
+
+	req.Header.Set("If-None-Match", res.Header().Get("ETag"))
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusNotModified || res.Body.Len() != 0 || len(res.Header().Get("Content-Encoding")) > 0 {
+		t.Error("expected:\t", "empty 304", "\tactual:\t", res.Code, res.Header(), res.Body.Len())
+	}
+}
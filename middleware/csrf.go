@@ -0,0 +1,208 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	CSRFCookieName = "csrf_token"   // the cookie holding the signed secret
+	CSRFFieldName  = "csrf_token"   // the form field a token is submitted in
+	CSRFHeader     = "X-CSRF-Token" // the header a token is submitted in, e.g. by scripts
+)
+
+// The length of the secret shared by a client's tokens
+const csrfSecretLength = 32
+
+var (
+	errCSRFNoCookie  = errors.New("csrf: missing or invalid cookie")
+	errCSRFNoToken   = errors.New("csrf: missing token")
+	errCSRFBadToken  = errors.New("csrf: token does not match")
+	errCSRFMalformed = errors.New("csrf: malformed token")
+)
+
+type csrfKey struct{}
+
+// csrfState is what CSRF stores in a request's context for CSRFToken
+type csrfState struct {
+	secret []byte
+	issue  atomic.Bool // set when a token is made for a new secret, which needs its cookie
+}
+
+// CSRF protects h from cross-site request forgery with signed double-submit cookies: each client
+// gets a random secret in a cookie signed with key, and requests with unsafe methods (anything
+// but GET, HEAD, OPTIONS, and TRACE) must submit a token for that secret, from CSRFToken, in
+// the X-CSRF-Token header or csrf_token form field. Requests that don't are passed to failure
+// with the reason instead of h, e.g. to respond with a 403 page, or answered with a plain 403
+// when failure is nil.
+// The cookie is only set on a response that makes a token, since such a response is specific to
+// the client; it is then sent with "Cache-Control: no-store". Responses without tokens are left
+// to be cached as usual. The cookie goes out with the headers, so a page that makes the first
+// token after starting its response, such as a streamed one, won't work for a new client.
+func CSRF(key []byte, failure func(http.ResponseWriter, *http.Request, error), h http.Handler) http.Handler {
+	if failure == nil {
+		failure = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := csrfSecret(key, r)
+		state := &csrfState{secret: secret}
+		if !ok {
+			state.secret = make([]byte, csrfSecretLength)
+			rand.Read(state.secret)
+			cw := &csrfWriter{ResponseWriter: w, set: func() {
+				if !state.issue.Load() {
+					return
+				}
+				http.SetCookie(w, &http.Cookie{
+					Name:     CSRFCookieName,
+					Value:    signCSRF(key, state.secret),
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   r.TLS != nil,
+					SameSite: http.SameSiteLaxMode,
+				})
+				w.Header().Set("Cache-Control", "no-store")
+				w.Header().Del("Expires")
+			}}
+			// a handler that writes nothing still gets its headers sent after it returns
+			defer cw.commit()
+			w = cw
+		}
+		r = r.WithContext(context.WithValue(r.Context(), csrfKey{}, state))
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			h.ServeHTTP(w, r)
+			return
+		}
+		err := errCSRFNoCookie
+		if ok {
+			err = checkCSRF(secret, r)
+		}
+		if err != nil {
+			failure(w, r, err)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// CSRFToken returns a token for the request with ctx to submit with a form or script, or ""
+// outside of CSRF. Each token is masked differently, so that pages don't repeat the secret.
+func CSRFToken(ctx context.Context) string {
+	state, ok := ctx.Value(csrfKey{}).(*csrfState)
+	if !ok {
+		return ""
+	}
+	state.issue.Store(true)
+	secret := state.secret
+	token := make([]byte, 2*len(secret))
+	rand.Read(token[:len(secret)])
+	for i := range secret {
+		token[len(secret)+i] = token[i] ^ secret[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// csrfSecret returns the secret from the request's cookie, if it has a valid signature
+func csrfSecret(key []byte, r *http.Request) ([]byte, bool) {
+	c, err := r.Cookie(CSRFCookieName)
+	if err != nil {
+		return nil, false
+	}
+	value, sig, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return nil, false
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(secret) != csrfSecretLength {
+		return nil, false
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(key, secret))) {
+		return nil, false
+	}
+	return secret, true
+}
+
+// checkCSRF compares the submitted token with the secret
+func checkCSRF(secret []byte, r *http.Request) error {
+	submitted := r.Header.Get(CSRFHeader)
+	if len(submitted) == 0 {
+		submitted = r.PostFormValue(CSRFFieldName)
+	}
+	if len(submitted) == 0 {
+		return errCSRFNoToken
+	}
+	token, err := base64.RawURLEncoding.DecodeString(submitted)
+	if err != nil || len(token) != 2*len(secret) {
+		return errCSRFMalformed
+	}
+	unmasked := make([]byte, len(secret))
+	for i := range unmasked {
+		unmasked[i] = token[i] ^ token[len(secret)+i]
+	}
+	if subtle.ConstantTimeCompare(unmasked, secret) != 1 {
+		return errCSRFBadToken
+	}
+	return nil
+}
+
+// signCSRF encodes the secret with its signature, for the cookie
+func signCSRF(key, secret []byte) string {
+	return base64.RawURLEncoding.EncodeToString(secret) + "." + signature(key, secret)
+}
+
+func signature(key, secret []byte) string {
+	m := hmac.New(sha256.New, key)
+	m.Write(secret)
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// csrfWriter sets the cookie for a new secret just before the response starts
+type csrfWriter struct {
+	http.ResponseWriter
+	set       func()
+	committed bool
+}
+
+func (w *csrfWriter) commit() {
+	if !w.committed {
+		w.committed = true
+		w.set()
+	}
+}
+
+func (w *csrfWriter) WriteHeader(status int) {
+	w.commit()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *csrfWriter) Write(b []byte) (int, error) {
+	w.commit()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the underlying ResponseWriter, if it can flush
+func (w *csrfWriter) Flush() {
+	w.commit()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter
+func (w *csrfWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// CSRF should issue a signed cookie, and only let unsafe requests through with a matching token
+func TestCSRF(t *testing.T) {
+	key := []byte("test key")
+	h := CSRF(key, nil, http.HandlerFunc(func(w http.ResponseWriter, q *http.Request) {
+		io.WriteString(w, CSRFToken(q.Context()))
+	}))
+
+	// a first visit gets a cookie and a token
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CSRFCookieName || !cookies[0].HttpOnly {
+		t.Fatal("expected:\t", "an HttpOnly csrf_token cookie", "\tactual:\t", cookies)
+	}
+	cookie := cookies[0]
+	token := res.Body.String()
+
+	// a second visit keeps the cookie, and gets a differently masked token
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if len(res.Result().Cookies()) != 0 {
+		t.Error("expected:\t", "no new cookie", "\tactual:\t", res.Result().Cookies())
+	}
+	if other := res.Body.String(); other == token || len(other) != len(token) {
+		t.Error("expected:\t", "a different token", "\tactual:\t", other, token)
+	}
+
+	forged := &http.Cookie{Name: CSRFCookieName, Value: strings.Replace(cookie.Value, ".", ".x", 1)}
+	type testCase struct {
+		Method string
+		Cookie *http.Cookie
+		Header string
+		Field  string
+		Status int
+	}
+
+	// method | cookie | header | field   | STATUS
+	// POST   | valid  | token  |         | 200
+	// POST   | valid  |        | token   | 200
+	// PUT    | valid  | token  |         | 200
+	// POST   | valid  |        |         | 403
+	// POST   | valid  | junk   |         | 403
+	// POST   | valid  | other  |         | 403
+	// POST   | none   | token  |         | 403
+	// POST   | forged | token  |         | 403
+	// DELETE | valid  |        |         | 403
+	otherToken := func() string {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+		return res.Body.String()
+	}()
+	testCases := []testCase{
+		{"POST", cookie, token, "", 200},
+		{"POST", cookie, "", token, 200},
+		{"PUT", cookie, token, "", 200},
+		{"POST", cookie, "", "", 403},
+		{"POST", cookie, "junk", "", 403},
+		{"POST", cookie, otherToken, "", 403},
+		{"POST", nil, token, "", 403},
+		{"POST", forged, token, "", 403},
+		{"DELETE", cookie, "", "", 403},
+	}
+	for idx, tc := range testCases {
+		form := url.Values{}
+		if len(tc.Field) > 0 {
+			form.Set(CSRFFieldName, tc.Field)
+		}
+		req := httptest.NewRequest(tc.Method, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if len(tc.Header) > 0 {
+			req.Header.Set(CSRFHeader, tc.Header)
+		}
+		if tc.Cookie != nil {
+			req.AddCookie(tc.Cookie)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != tc.Status {
+			t.Error("test\t", idx, "\texpected:\t", tc.Status, "\tactual:\t", res.Code)
+		}
+	}
+
+	if token := CSRFToken(httptest.NewRequest("GET", "/", nil).Context()); token != "" {
+		t.Error("expected:\t", "", "\tactual:\t", token)
+	}
+}
+
+// CSRF should only set the cookie on a response with a token, and keep that response out of
+// caches, whatever cache headers the handler set
+func TestCSRFCookieCaching(t *testing.T) {
+	key := []byte("test key")
+
+	// handler       | COOKIE | CACHE-CONTROL
+	// token, public | yes    | no-store
+	// public        | no     | public, max-age=60
+	// empty         | no     |
+	// token, empty  | yes    | no-store
+	type testCase struct {
+		Token        bool
+		Public       bool
+		Cookie       bool
+		CacheControl string
+	}
+	testCases := []testCase{
+		{true, true, true, "no-store"},
+		{false, true, false, "public, max-age=60"},
+		{false, false, false, ""},
+		{true, false, true, "no-store"},
+	}
+	for idx, tc := range testCases {
+		h := CSRF(key, nil, http.HandlerFunc(func(w http.ResponseWriter, q *http.Request) {
+			if tc.Token {
+				CSRFToken(q.Context())
+			}
+			if tc.Public {
+				w.Header().Set("Cache-Control", "public, max-age=60")
+				w.Header().Set("Expires", "Thu, 01 Jan 2099 00:00:00 GMT")
+				io.WriteString(w, "page")
+			}
+		}))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+		if cookie := len(res.Result().Cookies()) > 0; cookie != tc.Cookie {
+			t.Error("test\t", idx, "\texpected:\t", tc.Cookie, "\tactual:\t", res.Result().Cookies())
+		}
+		if cc := res.Header().Get("Cache-Control"); cc != tc.CacheControl {
+			t.Error("test\t", idx, "\texpected:\t", tc.CacheControl, "\tactual:\t", cc)
+		}
+		if expires := res.Header().Get("Expires"); tc.Cookie && len(expires) > 0 {
+			t.Error("test\t", idx, "\texpected:\t", "no Expires", "\tactual:\t", expires)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// ConsoleOptions adjust the handler created by NewConsoleHandler.
+type ConsoleOptions struct {
+	// Level is the minimum level logged; nil logs Info and above.
+	Level slog.Leveler
+
+	// NoTimestamp leaves the time off each line.
+	NoTimestamp bool
+
+	// NoColor turns off ANSI colors, which are otherwise used when writing to a terminal.
+	NoColor bool
+}
+
+// NewConsoleHandler creates a slog.Handler for reading logs as they happen: records from
+// AccessLog are written as "Served:" lines with the duration in µs, status, method, URL, and
+// request ID, marked "Served*" in red when slow (see Slow). Other records are written as the
+// message followed by key=value pairs. Colors are only used when w is a terminal.
+func NewConsoleHandler(w io.Writer, opts *ConsoleOptions) slog.Handler {
+	h := &consoleHandler{formatter: newFormatter(w)}
+	if opts != nil {
+		h.opts = *opts
+	}
+	h.color = !h.opts.NoColor && isTerminal(w)
+	return h
+}
+
+// NewCombinedHandler creates a slog.Handler that writes records from AccessLog in the Apache
+// combined log format, followed by the quoted request ID when there is one. Other records are
+// written as the time and message followed by key=value pairs.
+func NewCombinedHandler(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	h := &combinedHandler{formatter: newFormatter(w)}
+	if opts != nil {
+		h.level = opts.Level
+	}
+	return h
+}
+
+type consoleHandler struct {
+	*formatter
+	opts  ConsoleOptions
+	color bool
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return enabled(h.opts.Level, level)
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.formatter = h.withAttrs(attrs)
+	return &c
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.formatter = h.withGroup(name)
+	return &c
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := h.collect(r)
+	b := new(bytes.Buffer)
+	if !h.opts.NoTimestamp {
+		b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	}
+	if isAccess(attrs) {
+		d := attrs.get(DurationKey).Duration()
+		status := int(attrs.get(StatusKey).Int64())
+		message, color := "Served: ", "\x1b[1;36m"
+		if attrs.get(SlowKey).Bool() {
+			message, color = "Served*:", "\x1b[1;31m"
+		}
+		b.WriteString(h.paint(color, message))
+		b.WriteString(" ")
+		b.WriteString(h.paint("\x1b[34m", fmt.Sprintf("%8d", d.Microseconds())))
+		b.WriteString("µs ")
+		b.WriteString(h.paint(statusColor(status), strconv.Itoa(status)))
+		b.WriteString(" ")
+		b.WriteString(attrs.str(MethodKey))
+		b.WriteString(" ")
+		b.WriteString(h.paint("\x1b[33m", attrs.str(URLKey)))
+		if id := attrs.str(RequestIDKey); len(id) > 0 {
+			b.WriteString(" [" + id + "]")
+		}
+	} else {
+		if r.Level != slog.LevelInfo {
+			b.WriteString(h.paint(levelColor(r.Level), r.Level.String()))
+			b.WriteString(" ")
+		}
+		b.WriteString(r.Message)
+		attrs.writeTo(b)
+	}
+	b.WriteString("\n")
+	return h.write(b.Bytes())
+}
+
+// paint wraps s in an ANSI color, if colors are on
+func (h *consoleHandler) paint(color, s string) string {
+	if !h.color {
+		return s
+	}
+	return color + s + "\x1b[0m"
+}
+
+type combinedHandler struct {
+	*formatter
+	level slog.Leveler
+}
+
+func (h *combinedHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return enabled(h.level, level)
+}
+
+func (h *combinedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.formatter = h.withAttrs(attrs)
+	return &c
+}
+
+func (h *combinedHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.formatter = h.withGroup(name)
+	return &c
+}
+
+func (h *combinedHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := h.collect(r)
+	b := new(bytes.Buffer)
+	if !isAccess(attrs) {
+		fmt.Fprintf(b, "[%s] %s", r.Time.Format("02/Jan/2006:15:04:05 -0700"), r.Message)
+		attrs.writeTo(b)
+		b.WriteString("\n")
+		return h.write(b.Bytes())
+	}
+	remote := attrs.str(RemoteKey)
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	size := "-"
+	if n := attrs.get(BytesKey).Int64(); n > 0 {
+		size = strconv.FormatInt(n, 10)
+	}
+	fmt.Fprintf(b, "%s - - [%s] %s %d %s %s %s",
+		dash(remote),
+		r.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(attrs.str(MethodKey)+" "+attrs.str(URLKey)+" "+attrs.str(ProtoKey)),
+		attrs.get(StatusKey).Int64(),
+		size,
+		strconv.Quote(dash(attrs.str(RefererKey))),
+		strconv.Quote(dash(attrs.str(UserAgentKey))),
+	)
+	if id := attrs.str(RequestIDKey); len(id) > 0 {
+		b.WriteString(" " + strconv.Quote(id))
+	}
+	b.WriteString("\n")
+	return h.write(b.Bytes())
+}
+
+// formatter holds what the handlers here share: the writer, and attributes from WithAttrs
+type formatter struct {
+	lock   *sync.Mutex
+	w      io.Writer
+	attrs  []slog.Attr
+	prefix string // from WithGroup
+}
+
+func newFormatter(w io.Writer) *formatter {
+	return &formatter{lock: new(sync.Mutex), w: w}
+}
+
+func (f *formatter) withAttrs(attrs []slog.Attr) *formatter {
+	c := *f
+	c.attrs = append(append([]slog.Attr(nil), f.attrs...), f.prefixed(attrs)...)
+	return &c
+}
+
+func (f *formatter) withGroup(name string) *formatter {
+	c := *f
+	if len(name) > 0 {
+		c.prefix = f.prefix + name + "."
+	}
+	return &c
+}
+
+// prefixed adds the group prefix to the keys of attrs
+func (f *formatter) prefixed(attrs []slog.Attr) []slog.Attr {
+	if len(f.prefix) == 0 {
+		return attrs
+	}
+	p := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		p[i] = slog.Attr{Key: f.prefix + a.Key, Value: a.Value}
+	}
+	return p
+}
+
+// collect gathers the attributes from WithAttrs and the record, flattening groups
+func (f *formatter) collect(r slog.Record) attrList {
+	var attrs attrList
+	for _, a := range f.attrs {
+		attrs = attrs.add("", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = attrs.add(f.prefix, a)
+		return true
+	})
+	return attrs
+}
+
+func (f *formatter) write(b []byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	_, err := f.w.Write(b)
+	return err
+}
+
+// attrList is a flattened list of attributes, with group names joined to keys by "."
+type attrList []slog.Attr
+
+func (l attrList) add(prefix string, a slog.Attr) attrList {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return l
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if len(a.Key) > 0 {
+			prefix += a.Key + "."
+		}
+		for _, g := range a.Value.Group() {
+			l = l.add(prefix, g)
+		}
+		return l
+	}
+	a.Key = prefix + a.Key
+	return append(l, a)
+}
+
+// get returns the value of the last attribute with key, or the zero Value
+func (l attrList) get(key string) slog.Value {
+	for i := len(l) - 1; i >= 0; i-- {
+		if l[i].Key == key {
+			return l[i].Value
+		}
+	}
+	return slog.Value{}
+}
+
+// str returns the string value of the last attribute with key, or "" if there is none
+func (l attrList) str(key string) string {
+	if v := l.get(key); v.Kind() != slog.KindAny || v.Any() != nil {
+		return v.String()
+	}
+	return ""
+}
+
+func (l attrList) writeTo(b *bytes.Buffer) {
+	for _, a := range l {
+		b.WriteString(" ")
+		b.WriteString(a.Key)
+		b.WriteString("=")
+		s := a.Value.String()
+		if len(s) == 0 || bytes.ContainsAny([]byte(s), " =\"") {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(s)
+	}
+}
+
+// isAccess reports whether the attributes are those of a record from AccessLog
+func isAccess(attrs attrList) bool {
+	return attrs.get(StatusKey).Kind() == slog.KindInt64 && attrs.get(DurationKey).Kind() == slog.KindDuration
+}
+
+func enabled(min slog.Leveler, level slog.Level) bool {
+	if min == nil {
+		min = slog.LevelInfo
+	}
+	return level >= min.Level()
+}
+
+func dash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+func statusColor(status int) string {
+	switch {
+	case status >= 500:
+		return "\x1b[1;31m"
+	case status >= 400:
+		return "\x1b[33m"
+	case status >= 300:
+		return "\x1b[36m"
+	}
+	return "\x1b[32m"
+}
+
+func levelColor(level slog.Level) string {
+	if level >= slog.LevelError {
+		return "\x1b[1;31m"
+	}
+	if level >= slog.LevelWarn {
+		return "\x1b[33m"
+	}
+	return "\x1b[34m"
+}
+
+// isTerminal reports whether w is a terminal, rather than a file or pipe
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,46 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover catches a panic in h, logs it with the request URL and stack, and calls onPanic
+// with the panic as an error so that it can respond, e.g. with a 500 page; a nil onPanic
+// responds with a plain 500.
+// If h had already started its response, onPanic is not called, since the status and
+// headers are gone; what was written stands. A panic with http.ErrAbortHandler is passed
+// on, so that the server still aborts the response.
+func Recover(onPanic func(http.ResponseWriter, *http.Request, error), h http.Handler) http.Handler {
+	return http.HandlerFunc(func(r http.ResponseWriter, q *http.Request) {
+		w := wrap(r)
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			err, ok := v.(error)
+			if !ok {
+				err = fmt.Errorf("%v", v)
+			}
+			log.Printf("\x1b[1;31mPanic:\x1b[0m %s\x1b[33m%s\x1b[0m %v\n%s", RequestTag(q.Context()), q.URL.String(), err, debug.Stack())
+			if w.Written() {
+				return
+			}
+			if onPanic == nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			onPanic(w, q, fmt.Errorf("panic: %w", err))
+		}()
+		h.ServeHTTP(w, q)
+	})
+}
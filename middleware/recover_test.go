@@ -0,0 +1,94 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Recover should respond through onPanic when h panics before writing,
+// and leave the response alone when h had already started it.
+func TestRecover(t *testing.T) {
+	onPanic := func(w http.ResponseWriter, q *http.Request, err error) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "recovered: "+err.Error())
+	}
+	type testCase struct {
+		H      http.HandlerFunc
+		Status int
+		Body   string
+	}
+
+	// h                    | STATUS BODY
+	// no panic             | 200    ok
+	// panic string         | 500    recovered: panic: boom
+	// panic error          | 500    recovered: panic: bad error
+	// panic after writing  | 202    partial
+	testCases := []testCase{
+		{
+			H:      func(w http.ResponseWriter, q *http.Request) { io.WriteString(w, "ok") },
+			Status: http.StatusOK,
+			Body:   "ok",
+		},
+		{
+			H:      func(w http.ResponseWriter, q *http.Request) { panic("boom") },
+			Status: http.StatusInternalServerError,
+			Body:   "recovered: panic: boom",
+		},
+		{
+			H:      func(w http.ResponseWriter, q *http.Request) { panic(errors.New("bad error")) },
+			Status: http.StatusInternalServerError,
+			Body:   "recovered: panic: bad error",
+		},
+		{
+			H: func(w http.ResponseWriter, q *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				io.WriteString(w, "partial")
+				panic("late")
+			},
+			Status: http.StatusAccepted,
+			Body:   "partial",
+		},
+	}
+	for idx, tc := range testCases {
+		res := httptest.NewRecorder()
+		Recover(onPanic, tc.H).ServeHTTP(res, httptest.NewRequest("GET", "/panic", nil))
+		if res.Code != tc.Status {
+			t.Error("test\t", idx, "\texpected:\t", tc.Status, "\tactual:\t", res.Code)
+		}
+		if body := res.Body.String(); body != tc.Body {
+			t.Error("test\t", idx, "\texpected:\t", tc.Body, "\tactual:\t", body)
+		}
+	}
+}
+
+// Recover should pass on http.ErrAbortHandler, and respond with a plain 500 without onPanic
+func TestRecoverDefaults(t *testing.T) {
+	func() {
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Error("expected:\t", http.ErrAbortHandler, "\tactual:\t", v)
+			}
+		}()
+		Recover(nil, http.HandlerFunc(func(w http.ResponseWriter, q *http.Request) {
+			panic(http.ErrAbortHandler)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+
+	res := httptest.NewRecorder()
+	Recover(nil, http.HandlerFunc(func(w http.ResponseWriter, q *http.Request) {
+		panic("boom")
+	})).ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+	if res.Code != http.StatusInternalServerError {
+		t.Error("expected:\t", http.StatusInternalServerError, "\tactual:\t", res.Code)
+	}
+	if body := res.Body.String(); !strings.Contains(body, "Internal Server Error") {
+		t.Error("expected:\t", "Internal Server Error", "\tactual:\t", body)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header a request ID is read from and echoed in
+const RequestIDHeader = "X-Request-ID"
+
+// The longest request ID accepted from a client
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID gives each request served by h an ID, to correlate its log lines and error page:
+// the client's X-Request-ID when it is reasonable (printable ASCII, up to 128 characters),
+// otherwise a new random one. The ID is stored in the request's context, for RequestIDFrom,
+// and echoed in the response's X-Request-ID header.
+func RequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(r http.ResponseWriter, q *http.Request) {
+		id := q.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		r.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(r, q.WithContext(WithRequestID(q.Context(), id)))
+	})
+}
+
+// WithRequestID returns a copy of ctx with the request ID, e.g. for code that serves a
+// request outside of RequestID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID stored in ctx by RequestID, or "" if there is none.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a new random request ID
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether a client's request ID is safe to log and echo
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestTag formats the request ID in ctx for a log line, as "[id] ", or "" if there is none
+func RequestTag(ctx context.Context) string {
+	if id := RequestIDFrom(ctx); len(id) > 0 {
+		return "[" + id + "] "
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// RequestID should keep a reasonable client ID, or generate one, and share it
+// through the context and the response header
+func TestRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	type testCase struct {
+		Header string
+		Keep   bool
+	}
+
+	// header          | KEEP
+	// none            | no
+	// abc-123         | yes
+	// with space      | no
+	// too long        | no
+	testCases := []testCase{
+		{"", false},
+		{"abc-123", true},
+		{"with space", false},
+		{strings.Repeat("x", 200), false},
+	}
+	for idx, tc := range testCases {
+		var fromContext string
+		h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, q *http.Request) {
+			fromContext = RequestIDFrom(q.Context())
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		if len(tc.Header) > 0 {
+			req.Header.Set(RequestIDHeader, tc.Header)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+
+		echoed := res.Header().Get(RequestIDHeader)
+		if echoed != fromContext {
+			t.Error("test\t", idx, "\texpected:\t", fromContext, "\tactual:\t", echoed)
+		}
+		if tc.Keep && fromContext != tc.Header {
+			t.Error("test\t", idx, "\texpected:\t", tc.Header, "\tactual:\t", fromContext)
+		}
+		if !tc.Keep && !generated.MatchString(fromContext) {
+			t.Error("test\t", idx, "\texpected:\t", generated, "\tactual:\t", fromContext)
+		}
+	}
+	if id := RequestIDFrom(httptest.NewRequest("GET", "/", nil).Context()); id != "" {
+		t.Error("expected:\t", "", "\tactual:\t", id)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"net/http"
+)
+
+// responseWriter records what a handler has written, so that middleware can tell
+// whether the status line is already gone and report what was sent.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+// wrap returns w as a *responseWriter, reusing it if it already is one.
+func wrap(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+	return &responseWriter{ResponseWriter: w}
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush passes through to the underlying ResponseWriter, if it can flush
+func (w *responseWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status is the status sent, or 0 if nothing has been written yet
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// Written reports whether the status line and headers have been sent
+func (w *responseWriter) Written() bool {
+	return w.status != 0
+}
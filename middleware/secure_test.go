@@ -0,0 +1,63 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// SecureHeaders should set the policy's headers, with a new nonce for each request
+func TestSecureHeaders(t *testing.T) {
+	var nonces []string
+	h := SecureHeaders(DefaultSecurityPolicy, http.HandlerFunc(func(w http.ResponseWriter, q *http.Request) {
+		nonces = append(nonces, NonceFrom(q.Context()))
+	}))
+	var csps []string
+	for i := 0; i < 2; i++ {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+		expected := map[string]string{
+			"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "DENY",
+			"Referrer-Policy":           "strict-origin-when-cross-origin",
+		}
+		for k, v := range expected {
+			if actual := res.Header().Get(k); actual != v {
+				t.Error("test\t", i, "\t", k, "\texpected:\t", v, "\tactual:\t", actual)
+			}
+		}
+		csps = append(csps, res.Header().Get("Content-Security-Policy"))
+	}
+	if len(nonces[0]) == 0 || nonces[0] == nonces[1] {
+		t.Error("expected:\tdifferent nonces\tactual:\t", nonces)
+	}
+	for i, csp := range csps {
+		if !strings.Contains(csp, "'nonce-"+nonces[i]+"'") || strings.Contains(csp, NoncePlaceholder) {
+			t.Error("test\t", i, "\texpected:\t", "'nonce-"+nonces[i]+"'", "\tactual:\t", csp)
+		}
+	}
+
+	// an empty policy sets only nosniff, and no nonce
+	res := httptest.NewRecorder()
+	SecureHeaders(SecurityPolicy{}, http.HandlerFunc(func(w http.ResponseWriter, q *http.Request) {
+		if n := NonceFrom(q.Context()); n != "" {
+			t.Error("expected:\t", "", "\tactual:\t", n)
+		}
+	})).ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+	if len(res.Header()) != 1 || res.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("expected:\t", "X-Content-Type-Options: nosniff", "\tactual:\t", res.Header())
+	}
+
+	policy := SecurityPolicy{HSTS: time.Hour}
+	res = httptest.NewRecorder()
+	SecureHeaders(policy, http.NotFoundHandler()).ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+	if hsts := res.Header().Get("Strict-Transport-Security"); hsts != "max-age=3600; includeSubDomains" {
+		t.Error("expected:\t", "max-age=3600; includeSubDomains", "\tactual:\t", hsts)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultSlow is the duration over which a request is slow, unless set by Slow
+const DefaultSlow = 10 * time.Millisecond
+
+// Slow sets the duration over which requests served by h are considered slow, as reported
+// by AccessLog and SlowLog. Slow may wrap a single route to override a threshold set for
+// the whole site, since the innermost Slow is applied last.
+func Slow(threshold time.Duration, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(r http.ResponseWriter, q *http.Request) {
+		t, q := withTiming(q)
+		t.lock.Lock()
+		t.threshold = threshold
+		t.lock.Unlock()
+		h.ServeHTTP(r, q)
+	})
+}
+
+// RecordPhase adds the duration of a phase of the request with ctx, such as loading templates,
+// to what AccessLog and SlowLog report. It does nothing unless the request passed through one
+// of them, or Slow.
+func RecordPhase(ctx context.Context, name string, d time.Duration) {
+	t, ok := ctx.Value(timingKey{}).(*timing)
+	if !ok {
+		return
+	}
+	t.lock.Lock()
+	t.phases = append(t.phases, Phase{name, d})
+	t.lock.Unlock()
+}
+
+// Phase is the time spent in one part of a request
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// timing is shared through a request's context by the middleware here, so that
+// handlers within can set what middleware outside them reports
+type timing struct {
+	lock      sync.Mutex
+	threshold time.Duration
+	phases    []Phase
+}
+
+type timingKey struct{}
+
+// withTiming returns the timing for q, adding one to its context if it has none yet
+func withTiming(q *http.Request) (*timing, *http.Request) {
+	if t, ok := q.Context().Value(timingKey{}).(*timing); ok {
+		return t, q
+	}
+	t := &timing{threshold: DefaultSlow}
+	return t, q.WithContext(context.WithValue(q.Context(), timingKey{}, t))
+}
+
+// report returns the threshold and a copy of the phases recorded so far
+func (t *timing) report() (time.Duration, []Phase) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.threshold, append([]Phase(nil), t.phases...)
+}
+
+// SlowRequest describes a request that took longer than its threshold
+type SlowRequest struct {
+	Method   string
+	URL      string
+	Status   int
+	Start    time.Time
+	Duration time.Duration
+	Phases   []Phase
+}
+
+// SlowLog keeps the most recent slow requests in a ring buffer, and serves them,
+// slowest first, as a plain text report.
+type SlowLog struct {
+	lock     sync.Mutex
+	requests []SlowRequest
+	next     int
+}
+
+// Create a SlowLog holding the last size slow requests
+func NewSlowLog(size int) *SlowLog {
+	if size < 1 {
+		size = 1
+	}
+	return &SlowLog{requests: make([]SlowRequest, 0, size)}
+}
+
+// Track adds requests served by h to the log, when they are slow.
+func (s *SlowLog) Track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(r http.ResponseWriter, q *http.Request) {
+		start := time.Now()
+		t, q := withTiming(q)
+		w := wrap(r)
+		h.ServeHTTP(w, q)
+		d := time.Since(start)
+		threshold, phases := t.report()
+		if d <= threshold {
+			return
+		}
+		status := w.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.add(SlowRequest{
+			Method:   q.Method,
+			URL:      q.URL.String(),
+			Status:   status,
+			Start:    start,
+			Duration: d,
+			Phases:   phases,
+		})
+	})
+}
+
+func (s *SlowLog) add(r SlowRequest) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.requests) < cap(s.requests) {
+		s.requests = append(s.requests, r)
+		return
+	}
+	s.requests[s.next] = r
+	s.next = (s.next + 1) % len(s.requests)
+}
+
+// Requests returns the slow requests in the log, slowest first
+func (s *SlowLog) Requests() []SlowRequest {
+	s.lock.Lock()
+	requests := append([]SlowRequest(nil), s.requests...)
+	s.lock.Unlock()
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Duration > requests[j].Duration
+	})
+	return requests
+}
+
+// ServeHTTP reports the slow requests in the log, slowest first, one per line
+func (s *SlowLog) ServeHTTP(w http.ResponseWriter, q *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "DURATION\tSTATUS\tMETHOD\tURL\tSTARTED\tPHASES")
+	for _, r := range s.Requests() {
+		phases := make([]string, len(r.Phases))
+		for i, p := range r.Phases {
+			phases[i] = p.Name + "=" + p.Duration.Round(time.Microsecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", r.Duration.Round(time.Microsecond), r.Status, r.Method, r.URL, r.Start.Format(time.RFC3339), strings.Join(phases, " "))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// SlowLog should keep only the most recent slow requests, reported slowest first,
+// using the threshold from the innermost Slow
+func TestSlowLog(t *testing.T) {
+	sleep := func(d time.Duration) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, q *http.Request) {
+			RecordPhase(q.Context(), "sleep", d)
+			time.Sleep(d)
+		})
+	}
+	s := NewSlowLog(2)
+	mux := http.NewServeMux()
+	mux.Handle("/fast", sleep(0))
+	mux.Handle("/a", sleep(2*time.Millisecond))
+	mux.Handle("/b", sleep(6*time.Millisecond))
+	mux.Handle("/c", sleep(4*time.Millisecond))
+	mux.Handle("/lenient", Slow(time.Hour, sleep(2*time.Millisecond)))
+	h := Slow(time.Millisecond, s.Track(mux))
+
+	for _, p := range []string{"/fast", "/a", "/lenient", "/b", "/c"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+
+	// "/a" is pushed out by the later "/b" and "/c"; "/fast" and "/lenient" are never slow
+	expected := []string{"/b", "/c"}
+	actual := s.Requests()
+	if len(actual) != len(expected) {
+		t.Fatal("expected:\t", expected, "\tactual:\t", actual)
+	}
+	for idx, r := range actual {
+		if r.URL != expected[idx] {
+			t.Error("test\t", idx, "\texpected:\t", expected[idx], "\tactual:\t", r.URL)
+		}
+		if len(r.Phases) != 1 || r.Phases[0].Name != "sleep" {
+			t.Error("test\t", idx, "\texpected:\t", "[sleep]", "\tactual:\t", r.Phases)
+		}
+	}
+
+	res := httptest.NewRecorder()
+	s.ServeHTTP(res, httptest.NewRequest("GET", "/debug/slow", nil))
+	lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "/b") || !strings.Contains(lines[1], "sleep=6ms") {
+		t.Error("expected:\t", "header, /b, /c", "\tactual:\t", res.Body.String())
+	}
+}
@@ -0,0 +1,6 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+// Provides sessions kept in signed, and optionally encrypted, cookies, or on the server in
+// a Store with only a signed ID in the cookie.
+package sessions
@@ -0,0 +1,141 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// FileStore is a Store that keeps each session in a file in a folder, so they survive a
+// restart and can be shared by servers with the folder. Expired sessions are swept away
+// periodically.
+type FileStore struct {
+	dir     string
+	sweeper *sweeper
+}
+
+// Create a FileStore in dir, creating it if needed, that sweeps away expired sessions at
+// every interval, or never if the interval is 0. Anyone who can read dir can read every
+// session, so it must not be accessible to other users.
+func NewFileStore(dir string, interval time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Windows doesn't report permissions this way
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("sessions: %s is accessible to other users (%v)", dir, info.Mode().Perm())
+	}
+	s := &FileStore{dir: dir}
+	s.sweeper = startSweeper(interval, func() {
+		if err := s.Sweep(); err != nil {
+			log.Printf("\x1b[1;31mSession Sweep:\x1b[0m %v", err)
+		}
+	})
+	return s, nil
+}
+
+// A session's file holds its expiry, as Unix time, on the first line, then its data
+func (s *FileStore) Load(id string) ([]byte, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	b, err := os.ReadFile(filepath.Join(s.dir, id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	expires, data, ok := parseSessionFile(b)
+	if !ok || time.Now().After(expires) {
+		os.Remove(filepath.Join(s.dir, id))
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (s *FileStore) Save(id string, data []byte, expires time.Time) error {
+	if !validID(id) {
+		return errInvalidID
+	}
+	// write a temporary file and rename it, so a concurrent Load never sees part of a session
+	f, err := os.CreateTemp(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(strconv.FormatInt(expires.Unix(), 10) + "\n")
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(s.dir, id))
+}
+
+func (s *FileStore) Delete(id string) error {
+	if !validID(id) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(s.dir, id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Sweep removes the files of expired sessions
+func (s *FileStore) Sweep() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !validID(e.Name()) {
+			continue
+		}
+		name := filepath.Join(s.dir, e.Name())
+		b, err := os.ReadFile(name)
+		if err != nil {
+			continue // e.g. deleted since listing
+		}
+		if expires, _, ok := parseSessionFile(b); !ok || now.After(expires) {
+			os.Remove(name)
+		}
+	}
+	return nil
+}
+
+// Close stops sweeping
+func (s *FileStore) Close() error {
+	s.sweeper.stop()
+	return nil
+}
+
+func parseSessionFile(b []byte) (time.Time, []byte, bool) {
+	line, data, ok := bytes.Cut(b, []byte("\n"))
+	if !ok {
+		return time.Time{}, nil, false
+	}
+	unix, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil {
+		return time.Time{}, nil, false
+	}
+	return time.Unix(unix, 0), data, true
+}
@@ -0,0 +1,329 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lazyengineering/gobase/middleware"
+)
+
+// The name of the session cookie, unless a Manager sets another
+const DefaultName = "session"
+
+// Browsers may drop cookies longer than this
+const maxCookieLength = 4096
+
+var (
+	errNoSigningKey = errors.New("sessions: at least one signing key is required")
+	errInvalid      = errors.New("sessions: invalid cookie")
+	errExpired      = errors.New("sessions: expired cookie")
+	errTooLong      = errors.New("sessions: cookie too long")
+)
+
+// Manager keeps sessions in a cookie, signed with HMAC-SHA256 so that clients can read but not
+// change them, and also encrypted with AES-GCM when there are EncryptionKeys. The first of each
+// kind of key is used for new cookies; the others are still accepted, so that keys can be
+// rotated: put the new key first and keep the old one until its cookies have expired.
+//
+// With a Store, the sessions are kept on the server instead, and the cookie only holds the
+// session's ID, still signed and optionally encrypted.
+type Manager struct {
+	Name     string        // of the cookie; DefaultName when empty
+	Path     string        // of the cookie; "/" when empty
+	Domain   string        // of the cookie
+	MaxAge   time.Duration // how long a session lasts; 0 lasts until the browser closes
+	Secure   bool          // to only send the cookie over HTTPS
+	SameSite http.SameSite // of the cookie; Lax when unset
+	Store    Store         // keeps the sessions on the server, when set
+
+	signingKeys    [][]byte
+	encryptionKeys []cipher.AEAD
+}
+
+// Create a Manager with keys for signing cookies, and optionally encrypting them. Encryption
+// keys must be 16, 24, or 32 bytes, for AES-128, AES-192, or AES-256.
+func New(signingKeys [][]byte, encryptionKeys [][]byte) (*Manager, error) {
+	if len(signingKeys) == 0 {
+		return nil, errNoSigningKey
+	}
+	m := &Manager{signingKeys: signingKeys}
+	for _, k := range encryptionKeys {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, fmt.Errorf("sessions: encryption key: %w", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		m.encryptionKeys = append(m.encryptionKeys, aead)
+	}
+	return m, nil
+}
+
+// Handler loads the client's session, or a new one, into the request's context for From, and
+// saves it in a cookie before h starts its response, if h changed it. Changes made after the
+// response starts can't be saved, so pages that show flashes should not be streamed (see
+// layouts.Options.Stream). A response that sets the cookie is sent with
+// "Cache-Control: no-store", so that no cache gives it to another client. An invalid or
+// expired cookie gets a new session. When the Store fails to load a session, the request is
+// served without one, so From returns nil, and the cookie is left alone, so that a passing
+// failure doesn't end the session.
+func (m *Manager) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := m.load(r)
+		switch {
+		case err == nil, err == http.ErrNoCookie:
+		case err == errInvalid, err == errExpired, errors.Is(err, ErrNotFound):
+			s = &Session{changed: true} // replace the bad cookie
+		default:
+			h.ServeHTTP(w, r)
+			return
+		}
+		sw := &sessionWriter{ResponseWriter: w, save: func() { m.save(w, r, s) }}
+		h.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), sessionKey{}, s)))
+		sw.commit()
+	})
+}
+
+// the data kept in a cookie
+type cookieData struct {
+	Values  map[string]string `json:"v,omitempty"`
+	Flashes []Flash           `json:"f,omitempty"`
+	Expires int64             `json:"e,omitempty"` // Unix time
+}
+
+// load decodes the session from the request's cookie
+func (m *Manager) load(r *http.Request) (*Session, error) {
+	c, err := r.Cookie(m.name())
+	if err != nil {
+		return new(Session), err
+	}
+	payload, current, err := m.decode(c.Value)
+	if err != nil {
+		return nil, err
+	}
+	var id string
+	if m.Store != nil {
+		id = string(payload)
+		if payload, err = m.Store.Load(id); err != nil {
+			if err != ErrNotFound {
+				log.Printf("\x1b[1;31mSession:\x1b[0m %s%s %v", middleware.RequestTag(r.Context()), r.URL.String(), err)
+			}
+			return nil, err
+		}
+	}
+	var d cookieData
+	if err := json.Unmarshal(payload, &d); err != nil {
+		return nil, errInvalid
+	}
+	if d.Expires > 0 && time.Now().Unix() > d.Expires {
+		return nil, errExpired
+	}
+	// cookies from rotated keys are saved again with the current keys
+	return &Session{values: d.Values, flashes: d.Flashes, changed: !current, id: id}, nil
+}
+
+// save sets the session's cookie, if it changed, or deletes it when the session is empty
+func (m *Manager) save(w http.ResponseWriter, r *http.Request, s *Session) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.changed {
+		return
+	}
+	s.changed = false
+	c := &http.Cookie{
+		Name:     m.name(),
+		Path:     m.Path,
+		Domain:   m.Domain,
+		Secure:   m.Secure,
+		HttpOnly: true,
+		SameSite: m.SameSite,
+	}
+	if len(c.Path) == 0 {
+		c.Path = "/"
+	}
+	if c.SameSite == 0 {
+		c.SameSite = http.SameSiteLaxMode
+	}
+	if s.empty() {
+		if m.Store != nil && len(s.id) > 0 {
+			if err := m.Store.Delete(s.id); err != nil {
+				log.Printf("\x1b[1;31mSession:\x1b[0m %s%s %v", middleware.RequestTag(r.Context()), r.URL.String(), err)
+			}
+		}
+		s.id, s.renew = "", false
+		c.MaxAge = -1
+		setCookie(w, c)
+		return
+	}
+	d := cookieData{Values: s.values, Flashes: s.flashes}
+	var expires time.Time
+	if m.MaxAge > 0 {
+		expires = time.Now().Add(m.MaxAge)
+		d.Expires = expires.Unix()
+		c.Expires = expires
+		c.MaxAge = int(m.MaxAge.Seconds())
+	}
+	payload, err := json.Marshal(d)
+	if err == nil && m.Store != nil {
+		payload, err = m.store(s, payload, expires)
+	}
+	if err == nil {
+		c.Value, err = m.encode(payload)
+	}
+	if err != nil {
+		log.Printf("\x1b[1;31mSession:\x1b[0m %s%s %v", middleware.RequestTag(r.Context()), r.URL.String(), err)
+		return
+	}
+	setCookie(w, c)
+}
+
+// setCookie sets the cookie on a response that no cache may store, since it is for one client
+func setCookie(w http.ResponseWriter, c *http.Cookie) {
+	http.SetCookie(w, c)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Del("Expires")
+}
+
+// store saves the session's data in the Store, returning its ID for the cookie. The lock
+// must be held.
+func (m *Manager) store(s *Session, data []byte, expires time.Time) ([]byte, error) {
+	if s.renew && len(s.id) > 0 {
+		if err := m.Store.Delete(s.id); err != nil {
+			return nil, err
+		}
+		s.id = ""
+	}
+	s.renew = false
+	if len(s.id) == 0 {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		s.id = id
+	}
+	if expires.IsZero() {
+		expires = time.Now().Add(DefaultStoreAge)
+	}
+	return []byte(s.id), m.Store.Save(s.id, data, expires)
+}
+
+// encode encrypts, when there are encryption keys, and signs a cookie's payload
+func (m *Manager) encode(payload []byte) (string, error) {
+	if len(m.encryptionKeys) > 0 {
+		aead := m.encryptionKeys[0]
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload = aead.Seal(nonce, nonce, payload, []byte(m.name()))
+	}
+	data := base64.RawURLEncoding.EncodeToString(payload)
+	value := data + "." + m.sign(m.signingKeys[0], data)
+	if len(value) > maxCookieLength {
+		return "", errTooLong
+	}
+	return value, nil
+}
+
+// decode verifies and decrypts a cookie's value, and reports whether it used the current keys
+func (m *Manager) decode(value string) ([]byte, bool, error) {
+	data, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, false, errInvalid
+	}
+	signed := -1
+	for i, k := range m.signingKeys {
+		if hmac.Equal([]byte(sig), []byte(m.sign(k, data))) {
+			signed = i
+			break
+		}
+	}
+	if signed < 0 {
+		return nil, false, errInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, false, errInvalid
+	}
+	if len(m.encryptionKeys) == 0 {
+		return payload, signed == 0, nil
+	}
+	for i, aead := range m.encryptionKeys {
+		if len(payload) < aead.NonceSize() {
+			break
+		}
+		nonce, sealed := payload[:aead.NonceSize()], payload[aead.NonceSize():]
+		if opened, err := aead.Open(nil, nonce, sealed, []byte(m.name())); err == nil {
+			return opened, signed == 0 && i == 0, nil
+		}
+	}
+	return nil, false, errInvalid
+}
+
+// sign returns the signature of a cookie's data, which also covers the cookie's name
+func (m *Manager) sign(key []byte, data string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(m.name() + "|" + data))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (m *Manager) name() string {
+	if len(m.Name) > 0 {
+		return m.Name
+	}
+	return DefaultName
+}
+
+// sessionWriter saves the session just before the response starts
+type sessionWriter struct {
+	http.ResponseWriter
+	save      func()
+	committed bool
+}
+
+func (w *sessionWriter) commit() {
+	if !w.committed {
+		w.committed = true
+		w.save()
+	}
+}
+
+func (w *sessionWriter) WriteHeader(status int) {
+	w.commit()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.commit()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the underlying ResponseWriter, if it can flush
+func (w *sessionWriter) Flush() {
+	w.commit()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
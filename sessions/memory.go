@@ -0,0 +1,83 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package sessions
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps sessions in memory, so they are lost on restart and
+// not shared between servers. Expired sessions are swept away periodically.
+type MemoryStore struct {
+	lock     sync.Mutex
+	sessions map[string]memorySession
+	sweeper  *sweeper
+}
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+// Create a MemoryStore that sweeps away expired sessions at every interval, or never if
+// the interval is 0, in which case they are only dropped when loaded.
+func NewMemoryStore(interval time.Duration) *MemoryStore {
+	s := &MemoryStore{sessions: make(map[string]memorySession)}
+	s.sweeper = startSweeper(interval, s.Sweep)
+	return s
+}
+
+func (s *MemoryStore) Load(id string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	m, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if time.Now().After(m.expires) {
+		delete(s.sessions, id)
+		return nil, ErrNotFound
+	}
+	return m.data, nil
+}
+
+func (s *MemoryStore) Save(id string, data []byte, expires time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sessions[id] = memorySession{append([]byte(nil), data...), expires}
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// Sweep removes the expired sessions
+func (s *MemoryStore) Sweep() {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, m := range s.sessions {
+		if now.After(m.expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// Len returns the number of sessions, including any that expired since the last Sweep
+func (s *MemoryStore) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.sessions)
+}
+
+// Close stops sweeping
+func (s *MemoryStore) Close() error {
+	s.sweeper.stop()
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"sync"
+)
+
+// Session holds the values and flash messages for one client. Its methods are safe to call
+// concurrently (e.g. from Actions merged with layouts.MergeActions), and on a nil *Session,
+// which has no values and ignores changes.
+type Session struct {
+	lock    sync.Mutex
+	values  map[string]string
+	flashes []Flash
+	changed bool   // to be saved with the response
+	id      string // in the Manager's Store, if it has one
+	renew   bool   // to save with a new id
+}
+
+// Flash is a message shown once, on the next page rendered for the client
+type Flash struct {
+	Kind    string // e.g. "success", "info", "warning", or "danger", to style the message
+	Message string
+}
+
+type sessionKey struct{}
+
+// From returns the Session stored in ctx by Manager.Handler, or nil if there is none. Actions
+// cached by layouts get nil unless the cache Key varies on the session cookie.
+func From(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// Without returns a copy of ctx without its Session, so that From returns nil, e.g. for work
+// whose results are shared by every client.
+func Without(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, (*Session)(nil))
+}
+
+// Get returns the value for key, or "" if it is not set
+func (s *Session) Get(key string) string {
+	if s == nil {
+		return ""
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.values[key]
+}
+
+// Set the value for key
+func (s *Session) Set(key, value string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]string)
+	}
+	s.values[key] = value
+	s.changed = true
+}
+
+// Delete the value for key
+func (s *Session) Delete(key string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+// Clear removes every value and flash message, e.g. to log out
+func (s *Session) Clear() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values, s.flashes = nil, nil
+	s.changed = true
+}
+
+// Renew gives the session a new ID in the Manager's Store when it is saved, and removes the
+// old one, so that an ID seen before signing in can't be used afterwards. Without a Store,
+// it just signs the cookie again.
+func (s *Session) Renew() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.renew = true
+	s.changed = true
+}
+
+// AddFlash adds a message to show on the next page rendered for the client
+func (s *Session) AddFlash(kind, message string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.flashes = append(s.flashes, Flash{kind, message})
+	s.changed = true
+}
+
+// Flashes returns the flash messages and removes them from the session, so each is shown once
+func (s *Session) Flashes() []Flash {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	flashes := s.flashes
+	if len(flashes) > 0 {
+		s.flashes = nil
+		s.changed = true
+	}
+	return flashes
+}
+
+// empty reports whether there is nothing to keep; the lock must be held
+func (s *Session) empty() bool {
+	return len(s.values) == 0 && len(s.flashes) == 0
+}
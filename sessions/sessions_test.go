@@ -0,0 +1,222 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package sessions
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve a request with the cookie, if any, returning the response
+func serve(m *Manager, cookie *http.Cookie, h func(*Session, io.Writer)) *http.Response {
+	req := httptest.NewRequest("GET", "/", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	res := httptest.NewRecorder()
+	m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(From(r.Context()), w)
+	})).ServeHTTP(res, req)
+	return res.Result()
+}
+
+func sessionCookie(t *testing.T, res *http.Response) *http.Cookie {
+	t.Helper()
+	for _, c := range res.Cookies() {
+		if c.Name == DefaultName {
+			return c
+		}
+	}
+	t.Fatal("expected:\t", "a session cookie", "\tactual:\t", res.Cookies())
+	return nil
+}
+
+func mustNew(t *testing.T, signing, encryption [][]byte) *Manager {
+	t.Helper()
+	m, err := New(signing, encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// Values and flashes should survive between requests, flashes only until they are read
+func TestHandler(t *testing.T) {
+	m := mustNew(t, [][]byte{[]byte("key")}, nil)
+
+	res := serve(m, nil, func(s *Session, w io.Writer) {
+		s.Set("user", "jesse")
+		s.AddFlash("success", "Signed in")
+	})
+	cookie := sessionCookie(t, res)
+	if !cookie.HttpOnly || cookie.Path != "/" || cookie.SameSite != http.SameSiteLaxMode {
+		t.Error("expected:\t", "an HttpOnly, Lax cookie for /", "\tactual:\t", cookie)
+	}
+	if cc := res.Header.Get("Cache-Control"); cc != "no-store" {
+		t.Error("expected:\t", "no-store", "\tactual:\t", cc)
+	}
+
+	res = serve(m, cookie, func(s *Session, w io.Writer) {
+		body := s.Get("user")
+		for _, f := range s.Flashes() {
+			body += " " + f.Kind + ":" + f.Message
+		}
+		io.WriteString(w, body)
+	})
+	if body, _ := io.ReadAll(res.Body); string(body) != "jesse success:Signed in" {
+		t.Error("expected:\t", "jesse success:Signed in", "\tactual:\t", string(body))
+	}
+	cookie = sessionCookie(t, res) // saved again without the flash
+
+	res = serve(m, cookie, func(s *Session, w io.Writer) {
+		if f := s.Flashes(); len(f) != 0 {
+			t.Error("expected:\t", "no flashes", "\tactual:\t", f)
+		}
+	})
+	if len(res.Cookies()) != 0 {
+		t.Error("expected:\t", "no cookie for an unchanged session", "\tactual:\t", res.Cookies())
+	}
+
+	res = serve(m, cookie, func(s *Session, w io.Writer) {
+		s.Clear()
+	})
+	if c := sessionCookie(t, res); c.MaxAge >= 0 {
+		t.Error("expected:\t", "the cookie deleted", "\tactual:\t", c)
+	}
+}
+
+// Cookies that were tampered with, or signed or encrypted with unknown keys, should be ignored
+func TestInvalidCookies(t *testing.T) {
+	signed := mustNew(t, [][]byte{[]byte("key")}, nil)
+	encrypted := mustNew(t, [][]byte{[]byte("key")}, [][]byte{[]byte("0123456789abcdef")})
+	set := func(s *Session, w io.Writer) { s.Set("user", "jesse") }
+	signedCookie := sessionCookie(t, serve(signed, nil, set))
+	encryptedCookie := sessionCookie(t, serve(encrypted, nil, set))
+	data, sig, _ := strings.Cut(signedCookie.Value, ".")
+
+	type testCase struct {
+		Manager *Manager
+		Value   string
+	}
+
+	// manager                         | value
+	// signed                          | signed by another key
+	// signed                          | data changed
+	// signed                          | no signature
+	// signed                          | encrypted
+	// encrypted                       | signed, not encrypted
+	// encrypted with another key      | encrypted
+	testCases := []testCase{
+		{mustNew(t, [][]byte{[]byte("other")}, nil), signedCookie.Value},
+		{signed, "x" + data + "." + sig},
+		{signed, data},
+		{signed, encryptedCookie.Value},
+		{encrypted, signedCookie.Value},
+		{mustNew(t, [][]byte{[]byte("key")}, [][]byte{[]byte("fedcba9876543210")}), encryptedCookie.Value},
+	}
+
+	for idx, tc := range testCases {
+		res := serve(tc.Manager, &http.Cookie{Name: DefaultName, Value: tc.Value}, func(s *Session, w io.Writer) {
+			io.WriteString(w, s.Get("user"))
+		})
+		if body, _ := io.ReadAll(res.Body); len(body) != 0 {
+			t.Error("test\t", idx, "\texpected:\t", "", "\tactual:\t", string(body))
+		}
+		if c := sessionCookie(t, res); c.MaxAge >= 0 {
+			t.Error("test\t", idx, "\texpected:\t", "the cookie deleted", "\tactual:\t", c)
+		}
+	}
+}
+
+// Cookies from old keys should still be read, and saved again with the new keys
+func TestKeyRotation(t *testing.T) {
+	oldSign, newSign := []byte("old"), []byte("new")
+	oldEncrypt, newEncrypt := []byte("0123456789abcdef"), []byte("fedcba9876543210")
+	old := mustNew(t, [][]byte{oldSign}, [][]byte{oldEncrypt})
+	cookie := sessionCookie(t, serve(old, nil, func(s *Session, w io.Writer) { s.Set("user", "jesse") }))
+
+	rotated := mustNew(t, [][]byte{newSign, oldSign}, [][]byte{newEncrypt, oldEncrypt})
+	res := serve(rotated, cookie, func(s *Session, w io.Writer) { io.WriteString(w, s.Get("user")) })
+	if body, _ := io.ReadAll(res.Body); string(body) != "jesse" {
+		t.Error("expected:\t", "jesse", "\tactual:\t", string(body))
+	}
+	cookie = sessionCookie(t, res)
+
+	current := mustNew(t, [][]byte{newSign}, [][]byte{newEncrypt})
+	res = serve(current, cookie, func(s *Session, w io.Writer) { io.WriteString(w, s.Get("user")) })
+	if body, _ := io.ReadAll(res.Body); string(body) != "jesse" {
+		t.Error("expected:\t", "jesse", "\tactual:\t", string(body))
+	}
+}
+
+// Encrypted cookies should not reveal their values
+func TestEncryption(t *testing.T) {
+	m := mustNew(t, [][]byte{[]byte("key")}, [][]byte{[]byte("0123456789abcdef0123456789abcdef")})
+	cookie := sessionCookie(t, serve(m, nil, func(s *Session, w io.Writer) { s.Set("user", "jesse") }))
+	data, _, _ := strings.Cut(cookie.Value, ".")
+	if strings.Contains(cookie.Value, "jesse") || strings.Contains(data, "eyJ") { // base64 of `{"`
+		t.Error("expected:\t", "an encrypted cookie", "\tactual:\t", cookie.Value)
+	}
+}
+
+// Sessions past their MaxAge should be ignored, even if the browser still sends the cookie
+func TestMaxAge(t *testing.T) {
+	m := mustNew(t, [][]byte{[]byte("key")}, nil)
+	payload := `{"v":{"user":"jesse"},"e":1}` // expired long ago
+	value, err := m.encode([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := serve(m, &http.Cookie{Name: DefaultName, Value: value}, func(s *Session, w io.Writer) {
+		io.WriteString(w, s.Get("user"))
+	})
+	if body, _ := io.ReadAll(res.Body); len(body) != 0 {
+		t.Error("expected:\t", "", "\tactual:\t", string(body))
+	}
+
+	m.MaxAge = time.Hour
+	c := sessionCookie(t, serve(m, nil, func(s *Session, w io.Writer) { s.Set("user", "jesse") }))
+	if c.MaxAge != 3600 {
+		t.Error("expected:\t", 3600, "\tactual:\t", c.MaxAge)
+	}
+}
+
+// The cookie should be set even when the handler writes its response first
+func TestSaveBeforeWrite(t *testing.T) {
+	m := mustNew(t, [][]byte{[]byte("key")}, nil)
+	res := serve(m, nil, func(s *Session, w io.Writer) {
+		s.Set("user", "jesse")
+		io.WriteString(w, "body")
+		s.Set("late", "lost") // after the response started, so not saved
+	})
+	cookie := sessionCookie(t, res)
+	serve(m, cookie, func(s *Session, w io.Writer) {
+		if s.Get("user") != "jesse" || s.Get("late") != "" {
+			t.Error("expected:\t", "jesse only", "\tactual:\t", s.Get("user"), s.Get("late"))
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil, nil); err == nil {
+		t.Error("expected:\t", "an error without signing keys", "\tactual:\t", err)
+	}
+	if _, err := New([][]byte{[]byte("key")}, [][]byte{[]byte("short")}); err == nil {
+		t.Error("expected:\t", "an error for a bad encryption key", "\tactual:\t", err)
+	}
+}
+
+// A nil Session should have nothing, and ignore changes
+func TestNilSession(t *testing.T) {
+	var s *Session
+	s.Set("user", "jesse")
+	s.AddFlash("info", "hello")
+	if s.Get("user") != "" || s.Flashes() != nil {
+		t.Error("expected:\t", "nothing", "\tactual:\t", s.Get("user"), s.Flashes())
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+// How long a stored session lasts after it last changed, when the Manager has no MaxAge,
+// since the server can't tell when the browser is closed
+const DefaultStoreAge = 24 * time.Hour
+
+// Returned by a Store's Load for a session that doesn't exist or has expired
+var ErrNotFound = errors.New("sessions: not found")
+
+var errInvalidID = errors.New("sessions: invalid session ID")
+
+// A Store keeps sessions on the server, so that the cookie only holds a signed session ID.
+// The data is opaque to the Store; it is what the cookie would have held without one.
+// Concurrent requests in one session each save their own copy, and the last one wins.
+type Store interface {
+	// Load returns the data saved for id, or ErrNotFound
+	Load(id string) ([]byte, error)
+	// Save the data for id until it expires
+	Save(id string, data []byte, expires time.Time) error
+	// Delete the data for id, if there is any
+	Delete(id string) error
+}
+
+// newID returns a random session ID, safe to use in cookies and file names
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validID reports whether id could have come from newID
+func validID(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(32) {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// sweeper calls sweep at every interval until it is stopped
+type sweeper struct {
+	once sync.Once
+	done chan struct{}
+}
+
+func startSweeper(interval time.Duration, sweep func()) *sweeper {
+	s := &sweeper{done: make(chan struct{})}
+	if interval <= 0 {
+		return s
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				sweep()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *sweeper) stop() {
+	s.once.Do(func() { close(s.done) })
+}
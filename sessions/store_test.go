@@ -0,0 +1,209 @@
+// Copyright 2016 Jesse Allen. All rights reserved
+// Released under the MIT license found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Both stores should load what was saved until it expires or is deleted, and sweep expired sessions
+func TestStores(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	files, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := NewMemoryStore(0)
+	type sweepStore interface {
+		Store
+		Close() error
+	}
+	sweep := map[string]func() error{
+		"memory": func() error { memory.Sweep(); return nil },
+		"file":   files.Sweep,
+	}
+	stores := map[string]sweepStore{"memory": memory, "file": files}
+
+	for name, s := range stores {
+		live, expired, deleted := mustID(t), mustID(t), mustID(t)
+		for _, id := range []string{live, deleted} {
+			if err := s.Save(id, []byte(`{"v":{"user":"jesse"}}`), time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(name, err)
+			}
+		}
+		if err := s.Save(expired, []byte("{}"), time.Now().Add(-time.Second)); err != nil {
+			t.Fatal(name, err)
+		}
+		if err := s.Delete(deleted); err != nil {
+			t.Error(name, "\texpected:\t", nil, "\tactual:\t", err)
+		}
+		if err := sweep[name](); err != nil {
+			t.Error(name, "\texpected:\t", nil, "\tactual:\t", err)
+		}
+
+		type testCase struct {
+			ID   string
+			Data string
+			Err  error
+		}
+
+		// id       | DATA     | ERR
+		// live     | saved    | nil
+		// expired  |          | ErrNotFound
+		// deleted  |          | ErrNotFound
+		// unknown  |          | ErrNotFound
+		// ../x     |          | ErrNotFound
+		testCases := []testCase{
+			{live, `{"v":{"user":"jesse"}}`, nil},
+			{expired, "", ErrNotFound},
+			{deleted, "", ErrNotFound},
+			{mustID(t), "", ErrNotFound},
+			{"../" + live[3:], "", ErrNotFound},
+		}
+		for idx, tc := range testCases {
+			data, err := s.Load(tc.ID)
+			if string(data) != tc.Data || err != tc.Err {
+				t.Error(name, "\ttest\t", idx, "\texpected:\t", tc.Data, tc.Err, "\tactual:\t", string(data), err)
+			}
+		}
+		s.Close()
+	}
+
+	if n := memory.Len(); n != 1 {
+		t.Error("expected:\t", 1, "\tactual:\t", n)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Error("expected:\t", 1, "\tactual:\t", entries)
+	}
+}
+
+// A MemoryStore with an interval should sweep expired sessions by itself
+func TestMemoryStoreSweeping(t *testing.T) {
+	s := NewMemoryStore(time.Millisecond)
+	defer s.Close()
+	s.Save(mustID(t), []byte("{}"), time.Now().Add(5*time.Millisecond))
+	for deadline := time.Now().Add(time.Second); s.Len() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected:\t", 0, "\tactual:\t", s.Len())
+		}
+	}
+}
+
+// With a Store, the cookie should only hold the session's ID
+func TestManagerStore(t *testing.T) {
+	for name, s := range map[string]Store{"memory": NewMemoryStore(0), "file": mustFileStore(t)} {
+		m := mustNew(t, [][]byte{[]byte("key")}, nil)
+		m.Store = s
+
+		big := strings.Repeat("x", 8192) // too much for a cookie
+		cookie := sessionCookie(t, serve(m, nil, func(s *Session, w io.Writer) {
+			s.Set("user", "jesse")
+			s.Set("big", big)
+		}))
+		if strings.Contains(cookie.Value, "eyJ") || len(cookie.Value) > 200 { // base64 of `{"`
+			t.Error(name, "\texpected:\t", "only a signed ID", "\tactual:\t", cookie.Value)
+		}
+		res := serve(m, cookie, func(s *Session, w io.Writer) {
+			if s.Get("big") == big {
+				io.WriteString(w, s.Get("user"))
+			}
+		})
+		if body, _ := io.ReadAll(res.Body); string(body) != "jesse" {
+			t.Error(name, "\texpected:\t", "jesse", "\tactual:\t", string(body))
+		}
+
+		// renewing gives a new ID, and the old one no longer works
+		renewed := sessionCookie(t, serve(m, cookie, func(s *Session, w io.Writer) { s.Renew() }))
+		if renewed.Value == cookie.Value {
+			t.Error(name, "\texpected:\t", "a new ID", "\tactual:\t", renewed.Value)
+		}
+		serve(m, cookie, func(s *Session, w io.Writer) {
+			if s.Get("user") != "" {
+				t.Error(name, "\texpected:\t", "", "\tactual:\t", s.Get("user"))
+			}
+		})
+
+		// clearing deletes the session from the store
+		serve(m, renewed, func(s *Session, w io.Writer) { s.Clear() })
+		id, _, _ := m.decode(renewed.Value)
+		if _, err := s.Load(string(id)); err != ErrNotFound {
+			t.Error(name, "\texpected:\t", ErrNotFound, "\tactual:\t", err)
+		}
+	}
+}
+
+func mustID(t *testing.T) string {
+	t.Helper()
+	id, err := newID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func mustFileStore(t *testing.T) *FileStore {
+	t.Helper()
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "sessions"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// brokenStore fails to load any session, like a store with a passing disk or network error
+type brokenStore struct{ Store }
+
+func (brokenStore) Load(string) ([]byte, error) {
+	return nil, errors.New("disk error")
+}
+
+// When the Store fails, the request should be served without a session, and keep its cookie
+func TestManagerStoreFailure(t *testing.T) {
+	store := NewMemoryStore(0)
+	m := mustNew(t, [][]byte{[]byte("key")}, nil)
+	m.Store = store
+	cookie := sessionCookie(t, serve(m, nil, func(s *Session, w io.Writer) { s.Set("user", "jesse") }))
+
+	m.Store = brokenStore{store}
+	res := serve(m, cookie, func(s *Session, w io.Writer) {
+		if s != nil {
+			t.Error("expected:\t", "no session", "\tactual:\t", s)
+		}
+		s.Set("user", "someone else") // ignored
+	})
+	if len(res.Cookies()) != 0 {
+		t.Error("expected:\t", "the cookie left alone", "\tactual:\t", res.Cookies())
+	}
+
+	m.Store = store
+	serve(m, cookie, func(s *Session, w io.Writer) {
+		if s.Get("user") != "jesse" {
+			t.Error("expected:\t", "jesse", "\tactual:\t", s.Get("user"))
+		}
+	})
+}
+
+// A FileStore should refuse a folder other users can get into
+func TestFileStorePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not checked on windows")
+	}
+	dir := filepath.Join(t.TempDir(), "shared")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(dir, 0); err == nil {
+		t.Error("expected:\t", "an error for a shared folder", "\tactual:\t", err)
+	}
+}
@@ -0,0 +1,27 @@
+// Google Analytics for the account in this script's data-account, tracking outgoing links too.
+// It is a file rather than an inline script so that pages don't need a CSP nonce, and can be cached.
+var _gaq = _gaq || [];
+(function () {
+  var scripts = document.getElementsByTagName('script');
+  _gaq.push(['_setAccount', scripts[scripts.length - 1].getAttribute('data-account')]);
+  _gaq.push(['_setDomainName', 'runboyrunband.com']);
+  _gaq.push(['_trackPageview']);
+
+  var ga = document.createElement('script');
+  ga.type = 'text/javascript';
+  ga.async = true;
+  ga.src = ('https:' == document.location.protocol ? 'https://ssl' : 'http://www') + '.google-analytics.com/ga.js';
+  var s = document.getElementsByTagName('script')[0];
+  s.parentNode.insertBefore(ga, s);
+
+  if (window.location.host !== 'localhost') {
+    var a = document.getElementsByTagName('a');
+    for (var i = 0; i < a.length; i++) {
+      if (a[i].href.indexOf(location.host) == -1 && a[i].href.match(/^http:\/\//i)) {
+        a[i].onclick = function () {
+          _gaq.push(['_trackEvent', 'outgoing_links', this.href.replace(/^http:\/\//i, '')]);
+        }
+      }
+    }
+  }
+})();
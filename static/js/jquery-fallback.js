@@ -0,0 +1,7 @@
+// Loads the local copy of jQuery, from this script's data-src, when the CDN's copy didn't load.
+// It is a file rather than an inline script so that pages don't need a CSP nonce, and can be cached.
+(function () {
+  var scripts = document.getElementsByTagName('script');
+  var local = scripts[scripts.length - 1].getAttribute('data-src');
+  window.jQuery || document.write('<script src="' + local + '"><\/script>');
+})();